@@ -7,8 +7,8 @@ import (
 
 const (
 	min       = 1
-	max       = 200 // max possible allocations
-	allocated = 1   // allocated bit mark
+	max       = 65535 // largest possible channel id
+	allocated = 1     // allocated bit mark
 )
 
 // Allocator struct
@@ -19,28 +19,44 @@ type Allocator struct {
 	high int
 }
 
-// NewAllocator returns a new allocator
-func NewAllocator() *Allocator {
+// NewAllocator returns a new allocator of ids from 1 to high.
+// A high of zero, or above the largest channel id, allows every channel id.
+func NewAllocator(high int) *Allocator {
+	if high <= 0 || high > max {
+		high = max
+	}
 	al := &Allocator{
 		pool: big.NewInt(0),
-		last: min,
+		last: min - 1,
 		low:  min,
-		high: max,
+		high: high,
 	}
 	return al
 }
 
-// Next returns next int which can be allocated
+// Next returns next int which can be allocated. The search starts after the
+// last allocated int and wraps around, so released ints are not handed out
+// again while there are ints which have never been allocated.
 func (a *Allocator) Next() (int, bool) {
-	for ; a.last <= a.high; a.last++ {
-		if a.reserve(a.last) {
-			return a.last, true
+	size := a.high - a.low + 1
+	for i := 1; i <= size; i++ {
+		n := a.low + (a.last-a.low+i)%size
+		if a.reserve(n) {
+			a.last = n
+			return n, true
 		}
 	}
-	// TODO : If time permits implementation of freeing bit and allocating free bits for channel id
 	return 0, false
 }
 
+// Release frees n to be allocated again
+func (a *Allocator) Release(n int) {
+	if n < a.low || n > a.high {
+		return
+	}
+	a.pool.SetBit(a.pool, n-a.low, 0)
+}
+
 func (a *Allocator) reserve(n int) bool {
 	if a.reserved(n) {
 		return false
@@ -0,0 +1,157 @@
+package allocate
+
+import (
+	"testing"
+)
+
+// allocateAll takes ids from the allocator till it is exhausted
+func allocateAll(t *testing.T, a *Allocator) []int {
+	ids := make([]int, 0)
+	for {
+		n, ok := a.Next()
+		if !ok {
+			return ids
+		}
+		ids = append(ids, n)
+		if len(ids) > max {
+			t.Fatal("allocator handed out more ids than it holds")
+		}
+	}
+}
+
+func TestNextInOrder(t *testing.T) {
+	a := NewAllocator(5)
+	for want := 1; want <= 5; want++ {
+		n, ok := a.Next()
+		if !ok || n != want {
+			t.Fatalf("Next() = %d, %v, want %d, true", n, ok, want)
+		}
+	}
+}
+
+func TestNextExhausted(t *testing.T) {
+	a := NewAllocator(3)
+	ids := allocateAll(t, a)
+	if len(ids) != 3 {
+		t.Fatalf("allocated %v, want 3 ids", ids)
+	}
+
+	// Stays exhausted till an id is released
+	for i := 0; i < 3; i++ {
+		if n, ok := a.Next(); ok {
+			t.Fatalf("Next() = %d, true on an exhausted allocator", n)
+		}
+	}
+}
+
+func TestNextBoundedByHigh(t *testing.T) {
+	tests := []struct {
+		name string
+		high int
+		want int
+	}{
+		{"one", 1, 1},
+		{"channel max", 2047, 2047},
+		{"largest channel id", max, max},
+		{"zero allows every channel id", 0, max},
+		{"negative allows every channel id", -1, max},
+		{"above largest channel id", max + 10, max},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := allocateAll(t, NewAllocator(tt.high))
+			if len(ids) != tt.want {
+				t.Fatalf("allocated %d ids, want %d", len(ids), tt.want)
+			}
+			seen := make(map[int]bool, len(ids))
+			for _, n := range ids {
+				if n < min || n > tt.want {
+					t.Errorf("id %d out of range %d to %d", n, min, tt.want)
+				}
+				if seen[n] {
+					t.Errorf("id %d allocated twice", n)
+				}
+				seen[n] = true
+			}
+		})
+	}
+}
+
+func TestReleaseAndReuse(t *testing.T) {
+	a := NewAllocator(3)
+	allocateAll(t, a)
+
+	a.Release(2)
+	n, ok := a.Next()
+	if !ok || n != 2 {
+		t.Fatalf("Next() = %d, %v after releasing 2, want 2, true", n, ok)
+	}
+	if n, ok := a.Next(); ok {
+		t.Fatalf("Next() = %d, true, want the allocator exhausted again", n)
+	}
+}
+
+func TestNextWrapsAround(t *testing.T) {
+	a := NewAllocator(4)
+	for i := 0; i < 3; i++ {
+		a.Next()
+	}
+
+	// Ids after the last allocated are handed out before released ones
+	a.Release(1)
+	if n, _ := a.Next(); n != 4 {
+		t.Fatalf("Next() = %d, want 4 before wrapping around", n)
+	}
+	if n, _ := a.Next(); n != 1 {
+		t.Fatalf("Next() = %d, want 1 after wrapping around", n)
+	}
+}
+
+func TestNextSkipsReservedAfterWrap(t *testing.T) {
+	a := NewAllocator(5)
+	allocateAll(t, a)
+	a.Release(4)
+	a.Release(2)
+
+	// The search starts after 5, wraps around and finds 2, then 4
+	for _, want := range []int{2, 4} {
+		if n, ok := a.Next(); !ok || n != want {
+			t.Fatalf("Next() = %d, %v, want %d, true", n, ok, want)
+		}
+	}
+}
+
+func TestOpenCloseCycles(t *testing.T) {
+	a := NewAllocator(3)
+	for i := 0; i < 1000; i++ {
+		n, ok := a.Next()
+		if !ok {
+			t.Fatalf("allocator exhausted after %d open and close cycles", i)
+		}
+		a.Release(n)
+	}
+}
+
+func TestReleaseOutOfRange(t *testing.T) {
+	a := NewAllocator(2)
+	allocateAll(t, a)
+
+	// Releasing ids the allocator does not hold changes nothing
+	for _, n := range []int{-1, 0, 3, max + 1} {
+		a.Release(n)
+	}
+	if n, ok := a.Next(); ok {
+		t.Fatalf("Next() = %d, true, want the allocator exhausted", n)
+	}
+}
+
+func TestReleaseUnallocated(t *testing.T) {
+	a := NewAllocator(3)
+	a.Release(2)
+
+	ids := allocateAll(t, a)
+	if len(ids) != 3 {
+		t.Fatalf("allocated %v, want 3 ids", ids)
+	}
+}
@@ -1,9 +1,18 @@
 package proto
 
 const (
-	FrameMethod = 1
-	FrameHeader = 2
-	FrameBody   = 3
-	FrameEnd    = 206
-	FrameErr    = 501
+	FrameMethod    = 1
+	FrameHeader    = 2
+	FrameBody      = 3
+	FrameHeartbeat = 8
+	FrameEnd       = 206
+	FrameErr       = 501
+)
+
+// Frame size limits. The frame max negotiated with ConnectionTune is the
+// largest frame, including the frame header and frame end octet.
+// Till the connection is tuned, frames upto FrameMinSize are allowed.
+const (
+	FrameMinSize  = 4096
+	FrameOverhead = 8
 )
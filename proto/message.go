@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"strconv"
+	"time"
 )
 
 // ProtocolHeader struct represents the initial exchange between
@@ -83,7 +86,7 @@ func (hf *HeaderFrame) Write(w io.Writer) error {
 	}
 
 	// Set the properties mask bits
-	var mask uint8
+	var mask uint16
 
 	if len(hf.Properties.ContentType) > 0 {
 		mask = mask | flagContentType
@@ -97,6 +100,33 @@ func (hf *HeaderFrame) Write(w io.Writer) error {
 	if len(hf.Properties.ApplicationID) > 0 {
 		mask = mask | flagAppID
 	}
+	if len(hf.Properties.Headers) > 0 {
+		mask = mask | flagHeaders
+	}
+	if hf.Properties.DeliveryMode != 0 {
+		mask = mask | flagDeliveryMode
+	}
+	if len(hf.Properties.Expiration) > 0 {
+		mask = mask | flagExpiration
+	}
+	if hf.Properties.Priority != 0 {
+		mask = mask | flagPriority
+	}
+	if len(hf.Properties.ContentEncoding) > 0 {
+		mask = mask | flagContentEncoding
+	}
+	if len(hf.Properties.CorrelationID) > 0 {
+		mask = mask | flagCorrelationID
+	}
+	if len(hf.Properties.ReplyTo) > 0 {
+		mask = mask | flagReplyTo
+	}
+	if !hf.Properties.Timestamp.IsZero() {
+		mask = mask | flagTimestamp
+	}
+	if len(hf.Properties.Type) > 0 {
+		mask = mask | flagType
+	}
 
 	// Write the mask bits
 	if err := binary.Write(&payload, binary.BigEndian, mask); err != nil {
@@ -124,6 +154,51 @@ func (hf *HeaderFrame) Write(w io.Writer) error {
 			return err
 		}
 	}
+	if propertySet(mask, flagHeaders) {
+		if err := WriteTable(&payload, hf.Properties.Headers); err != nil {
+			return err
+		}
+	}
+	if propertySet(mask, flagDeliveryMode) {
+		if err := WriteOctet(&payload, hf.Properties.DeliveryMode); err != nil {
+			return err
+		}
+	}
+	if propertySet(mask, flagExpiration) {
+		if err := WriteShortStr(&payload, hf.Properties.Expiration); err != nil {
+			return err
+		}
+	}
+	if propertySet(mask, flagPriority) {
+		if err := WriteOctet(&payload, hf.Properties.Priority); err != nil {
+			return err
+		}
+	}
+	if propertySet(mask, flagContentEncoding) {
+		if err := WriteShortStr(&payload, hf.Properties.ContentEncoding); err != nil {
+			return err
+		}
+	}
+	if propertySet(mask, flagCorrelationID) {
+		if err := WriteShortStr(&payload, hf.Properties.CorrelationID); err != nil {
+			return err
+		}
+	}
+	if propertySet(mask, flagReplyTo) {
+		if err := WriteShortStr(&payload, hf.Properties.ReplyTo); err != nil {
+			return err
+		}
+	}
+	if propertySet(mask, flagTimestamp) {
+		if err := WriteLongLong(&payload, uint64(hf.Properties.Timestamp.Unix())); err != nil {
+			return err
+		}
+	}
+	if propertySet(mask, flagType) {
+		if err := WriteShortStr(&payload, hf.Properties.Type); err != nil {
+			return err
+		}
+	}
 
 	return writeFrame(w, FrameHeader, hf.ChannelID, payload.Bytes())
 }
@@ -141,6 +216,40 @@ func (bf *BodyFrame) Write(w io.Writer) error {
 	return writeFrame(w, FrameBody, bf.ChannelID, bf.Body)
 }
 
+// HeartbeatFrame struct is sent on channel 0 when the connection
+// is idle, to tell the peer the connection is alive
+type HeartbeatFrame struct{}
+
+// Channel returns the channel id
+func (*HeartbeatFrame) Channel() uint16 { return 0 }
+
+func (hb *HeartbeatFrame) Write(w io.Writer) error {
+	return writeFrame(w, FrameHeartbeat, 0, []byte{})
+}
+
+// BodyFrames splits the body into frames which fit in the frame max.
+// A zero frame max puts the whole body in one frame. An empty body
+// is sent as a single empty frame.
+func BodyFrames(channel uint16, body []byte, frameMax uint32) []*BodyFrame {
+	chunk := len(body)
+	if frameMax > FrameOverhead {
+		chunk = int(frameMax - FrameOverhead)
+	}
+
+	frames := make([]*BodyFrame, 0, 1)
+	for {
+		n := chunk
+		if n > len(body) {
+			n = len(body)
+		}
+		frames = append(frames, &BodyFrame{ChannelID: channel, Body: body[:n]})
+		body = body[n:]
+		if len(body) == 0 {
+			return frames
+		}
+	}
+}
+
 // Message struct contains the information required to send msg
 // Contains MessageContentFrame
 type Message struct {
@@ -157,6 +266,10 @@ type QueueMessage struct {
 	ID            int64
 	DeliveryCount int32
 	MsgSize       uint32
+	Persisted     bool
+	EnqueuedAt    int64
+	ExpiresAt     int64
+	Priority      uint8
 }
 
 // TxMessage struct
@@ -174,18 +287,43 @@ type IndexMessage struct {
 }
 
 const (
-	flagContentType = 0x020
-	flagMessageID   = 0x010
-	flagUserID      = 0x008
-	flagAppID       = 0x004
+	flagType            = 0x1000
+	flagTimestamp       = 0x0800
+	flagReplyTo         = 0x0400
+	flagCorrelationID   = 0x0200
+	flagContentEncoding = 0x0100
+	flagPriority        = 0x0080
+	flagHeaders         = 0x0040
+	flagContentType     = 0x0020
+	flagMessageID       = 0x0010
+	flagUserID          = 0x0008
+	flagAppID           = 0x0004
+	flagDeliveryMode    = 0x0002
+	flagExpiration      = 0x0001
+)
+
+// Delivery modes of a message. Persistent messages routed
+// to durable queues are restored after a server restart.
+const (
+	Transient  uint8 = 1
+	Persistent uint8 = 2
 )
 
 // Properties struct
 type Properties struct {
-	ContentType   string
-	MessageID     string
-	UserID        string
-	ApplicationID string
+	ContentType     string
+	ContentEncoding string
+	MessageID       string
+	CorrelationID   string
+	ReplyTo         string
+	UserID          string
+	ApplicationID   string
+	Type            string
+	Headers         Table
+	DeliveryMode    uint8
+	Expiration      string
+	Priority        uint8
+	Timestamp       time.Time
 }
 
 // NewMessage returns a new message. Takes MessageContentFrame as input
@@ -203,10 +341,102 @@ func NewMessage(mcf MessageContentFrame) *Message {
 		msg.Method = m
 		msg.Exchange = m.Exchange
 		msg.RoutingKey = m.RoutingKey
+	case *BasicGetOk:
+		msg.Method = m
+		msg.Exchange = m.Exchange
+		msg.RoutingKey = m.RoutingKey
 	}
 	return msg
 }
 
+// Persistent returns true if the message was published as persistent
+func (m *Message) Persistent() bool {
+	return m.Header != nil && m.Header.Properties.DeliveryMode == Persistent
+}
+
+// TTL returns the time to live of the message, given in milliseconds by its
+// expiration property. It returns false if the message does not expire.
+func (m *Message) TTL() (time.Duration, bool, error) {
+	if m.Header == nil || len(m.Header.Properties.Expiration) == 0 {
+		return 0, false, nil
+	}
+	ms, err := strconv.ParseInt(m.Header.Properties.Expiration, 10, 64)
+	if err != nil || ms < 0 {
+		return 0, false, fmt.Errorf("invalid expiration: %q", m.Header.Properties.Expiration)
+	}
+	return time.Duration(ms) * time.Millisecond, true, nil
+}
+
+// Encode returns the message encoded as its ID followed
+// by the method, header and body frames of the message
+func (m *Message) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := WriteLongLong(&buf, uint64(m.ID)); err != nil {
+		return nil, err
+	}
+
+	frames := []Frame{
+		&MethodFrame{Method: m.Method},
+		m.Header,
+		&BodyFrame{Body: m.Payload},
+	}
+	for _, f := range frames {
+		if err := f.Write(&buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeMessage returns the message from its encoding by Encode
+func DecodeMessage(data []byte) (*Message, error) {
+	buf := bytes.NewReader(data)
+
+	id, err := ReadLongLong(buf)
+	if err != nil {
+		return nil, errors.New("could not read message id: " + err.Error())
+	}
+
+	r := Reader{R: buf}
+
+	frame, err := r.ReadFrame()
+	if err != nil {
+		return nil, errors.New("could not read message method: " + err.Error())
+	}
+	mf, ok := frame.(*MethodFrame)
+	if !ok {
+		return nil, errors.New("expected method frame in message")
+	}
+	mcf, ok := mf.Method.(MessageContentFrame)
+	if !ok {
+		return nil, errors.New("expected content method in message")
+	}
+
+	msg := NewMessage(mcf)
+	msg.ID = int64(id)
+
+	frame, err = r.ReadFrame()
+	if err != nil {
+		return nil, errors.New("could not read message header: " + err.Error())
+	}
+	if msg.Header, ok = frame.(*HeaderFrame); !ok {
+		return nil, errors.New("expected header frame in message")
+	}
+
+	frame, err = r.ReadFrame()
+	if err != nil {
+		return nil, errors.New("could not read message body: " + err.Error())
+	}
+	bf, ok := frame.(*BodyFrame)
+	if !ok {
+		return nil, errors.New("expected body frame in message")
+	}
+	msg.Payload = bf.Body
+
+	return msg, nil
+}
+
 // NewTxMessage returns a new TxMessage.
 // Takes a pointer to Message and queue name as input
 func NewTxMessage(msg *Message, qn string) *TxMessage {
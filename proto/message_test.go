@@ -0,0 +1,73 @@
+package proto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBodyFrames(t *testing.T) {
+	const frameMax = FrameMinSize
+	const chunk = frameMax - FrameOverhead
+
+	tests := []struct {
+		name     string
+		size     int
+		frameMax uint32
+		want     []int
+	}{
+		{"empty body", 0, frameMax, []int{0}},
+		{"empty body without limit", 0, 0, []int{0}},
+		{"one byte", 1, frameMax, []int{1}},
+		{"one short of a frame", chunk - 1, frameMax, []int{chunk - 1}},
+		{"exactly one frame", chunk, frameMax, []int{chunk}},
+		{"one over a frame", chunk + 1, frameMax, []int{chunk, 1}},
+		{"exactly two frames", 2 * chunk, frameMax, []int{chunk, chunk}},
+		{"one over two frames", 2*chunk + 1, frameMax, []int{chunk, chunk, 1}},
+		{"no limit", 3 * chunk, 0, []int{3 * chunk}},
+		{"frame max within overhead", 10, FrameOverhead, []int{10}},
+		{"smallest useful frame max", 3, FrameOverhead + 1, []int{1, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := make([]byte, tt.size)
+			for i := range body {
+				body[i] = byte(i)
+			}
+
+			frames := BodyFrames(7, body, tt.frameMax)
+			if len(frames) != len(tt.want) {
+				t.Fatalf("got %d frames, want %d", len(frames), len(tt.want))
+			}
+
+			var joined []byte
+			for i, f := range frames {
+				if f.ChannelID != 7 {
+					t.Errorf("frame %d on channel %d, want 7", i, f.ChannelID)
+				}
+				if len(f.Body) != tt.want[i] {
+					t.Errorf("frame %d holds %d bytes, want %d", i, len(f.Body), tt.want[i])
+				}
+				joined = append(joined, f.Body...)
+			}
+			if !bytes.Equal(joined, body) {
+				t.Error("frames do not join back into the body")
+			}
+		})
+	}
+}
+
+func TestBodyFramesFitFrameMax(t *testing.T) {
+	const frameMax = FrameMinSize
+	body := make([]byte, 3*frameMax)
+
+	for _, f := range BodyFrames(1, body, frameMax) {
+		var buf bytes.Buffer
+		if err := f.Write(&buf); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		if buf.Len() > frameMax {
+			t.Errorf("frame written as %d bytes, exceeds frame max %d", buf.Len(), frameMax)
+		}
+	}
+}
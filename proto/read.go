@@ -1,15 +1,20 @@
 package proto
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"time"
 )
 
 // Reader struct
 type Reader struct {
 	R io.Reader
+	// FrameMax is the largest frame read. Zero means no limit.
+	FrameMax uint32
 }
 
 // ReadFrame read the frame from the connection and dispatches call
@@ -26,22 +31,40 @@ func (r Reader) ReadFrame() (frame Frame, err error) {
 	channel := binary.BigEndian.Uint16(incoming[1:3])
 	size := binary.BigEndian.Uint32(incoming[3:7])
 
+	// Oversized frames are rejected before the payload is read
+	if r.FrameMax > 0 && uint64(size)+FrameOverhead > uint64(r.FrameMax) {
+		return nil, NewHardError(FrameErr, fmt.Sprintf("Frame size %d exceeds frame max %d", uint64(size)+FrameOverhead, r.FrameMax), 0, 0)
+	}
+
+	payload, err := readBytes(r.R, size)
+	if err != nil {
+		return nil, err
+	}
+	fr := Reader{R: bytes.NewReader(payload)}
+
 	switch fType {
 
 	case FrameMethod:
-		if frame, err = r.readMethod(channel, size); err != nil {
+		if frame, err = fr.readMethod(channel, size); err != nil {
 			return nil, err
 		}
 
 	case FrameHeader:
-		if frame, err = r.readHeader(channel, size); err != nil {
+		if frame, err = fr.readHeader(channel, size); err != nil {
 			return nil, err
 		}
 
 	case FrameBody:
-		if frame, err = r.readBody(channel, size); err != nil {
-			return nil, err
+		frame = &BodyFrame{
+			ChannelID: channel,
+			Body:      payload,
+		}
+
+	case FrameHeartbeat:
+		if channel != 0 {
+			return nil, NewHardError(FrameErr, "Heartbeat frame on non-zero channel", 0, 0)
 		}
+		frame = &HeartbeatFrame{}
 
 	default:
 		return nil, NewHardError(FrameErr, "Frame could not be parsed", 0, 0)
@@ -58,8 +81,8 @@ func (r Reader) ReadFrame() (frame Frame, err error) {
 	return frame, nil
 }
 
-func propertySet(mask uint8, property int8) bool {
-	return int8(mask)&property > 0
+func propertySet(mask uint16, property uint16) bool {
+	return mask&property > 0
 }
 
 func (r Reader) readHeader(channel uint16, size uint32) (Frame, error) {
@@ -75,7 +98,7 @@ func (r Reader) readHeader(channel uint16, size uint32) (Frame, error) {
 		return nil, err
 	}
 
-	var flags uint8
+	var flags uint16
 	var err error
 
 	if err := binary.Read(r.R, binary.BigEndian, &flags); err != nil {
@@ -106,19 +129,63 @@ func (r Reader) readHeader(channel uint16, size uint32) (Frame, error) {
 		}
 	}
 
-	return hf, nil
-}
+	if propertySet(flags, flagHeaders) {
+		if hf.Properties.Headers, err = ReadTable(r.R); err != nil {
+			return nil, err
+		}
+	}
 
-func (r Reader) readBody(channel uint16, size uint32) (Frame, error) {
-	bf := &BodyFrame{
-		ChannelID: channel,
-		Body:      make([]byte, size),
+	if propertySet(flags, flagDeliveryMode) {
+		if hf.Properties.DeliveryMode, err = ReadOctet(r.R); err != nil {
+			return nil, err
+		}
 	}
 
-	if _, err := io.ReadFull(r.R, bf.Body); err != nil {
-		return nil, err
+	if propertySet(flags, flagExpiration) {
+		if hf.Properties.Expiration, err = ReadShortStr(r.R); err != nil {
+			return nil, err
+		}
+	}
+
+	if propertySet(flags, flagPriority) {
+		if hf.Properties.Priority, err = ReadOctet(r.R); err != nil {
+			return nil, err
+		}
+	}
+
+	if propertySet(flags, flagContentEncoding) {
+		if hf.Properties.ContentEncoding, err = ReadShortStr(r.R); err != nil {
+			return nil, err
+		}
+	}
+
+	if propertySet(flags, flagCorrelationID) {
+		if hf.Properties.CorrelationID, err = ReadShortStr(r.R); err != nil {
+			return nil, err
+		}
+	}
+
+	if propertySet(flags, flagReplyTo) {
+		if hf.Properties.ReplyTo, err = ReadShortStr(r.R); err != nil {
+			return nil, err
+		}
 	}
-	return bf, nil
+
+	if propertySet(flags, flagTimestamp) {
+		ts, err := ReadLongLong(r.R)
+		if err != nil {
+			return nil, err
+		}
+		hf.Properties.Timestamp = time.Unix(int64(ts), 0)
+	}
+
+	if propertySet(flags, flagType) {
+		if hf.Properties.Type, err = ReadShortStr(r.R); err != nil {
+			return nil, err
+		}
+	}
+
+	return hf, nil
 }
 
 // ReadOctet reads 1 byte of data
@@ -172,12 +239,20 @@ func readLongStr(r io.Reader) ([]byte, error) {
 	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
 		return nil, err
 	}
+	return readBytes(r, length)
+}
 
-	var slice = make([]byte, length)
-	if _, err := io.ReadFull(r, slice); err != nil {
+// readBytes reads length bytes. The buffer grows with the bytes read, so
+// a corrupt length cannot allocate more memory than the reader holds.
+func readBytes(r io.Reader, length uint32) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, int64(length)))
+	if err != nil {
 		return nil, err
 	}
-	return slice, nil
+	if uint32(len(data)) < length {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
 }
 
 // ReadLongStr reads a string of 4 bytes
@@ -225,6 +300,12 @@ func (r Reader) readMethod(channelID uint16, size uint32) (Frame, error) {
 
 		case mf.MethodID == 31:
 			method = &ConnectionCloseOk{}
+
+		case mf.MethodID == 40:
+			method = &ConnectionTune{}
+
+		case mf.MethodID == 41:
+			method = &ConnectionTuneOk{}
 		}
 
 	case mf.ClassID == 20:
@@ -300,6 +381,12 @@ func (r Reader) readMethod(channelID uint16, size uint32) (Frame, error) {
 
 		case mf.MethodID == 41:
 			method = &QueueDeleteOk{}
+
+		case mf.MethodID == 50:
+			method = &QueuePurge{}
+
+		case mf.MethodID == 51:
+			method = &QueuePurgeOk{}
 		}
 
 	case mf.ClassID == 50:
@@ -329,6 +416,21 @@ func (r Reader) readMethod(channelID uint16, size uint32) (Frame, error) {
 
 		case mf.MethodID == 70:
 			method = &BasicNack{}
+
+		case mf.MethodID == 80:
+			method = &BasicGet{}
+
+		case mf.MethodID == 81:
+			method = &BasicGetOk{}
+
+		case mf.MethodID == 82:
+			method = &BasicGetEmpty{}
+
+		case mf.MethodID == 90:
+			method = &BasicQos{}
+
+		case mf.MethodID == 91:
+			method = &BasicQosOk{}
 		}
 
 	case mf.ClassID == 60:
@@ -351,6 +453,15 @@ func (r Reader) readMethod(channelID uint16, size uint32) (Frame, error) {
 		case mf.MethodID == 31:
 			method = &TxRollbackOk{}
 		}
+
+	case mf.ClassID == 85:
+		switch {
+		case mf.MethodID == 10:
+			method = &ConfirmSelect{}
+
+		case mf.MethodID == 11:
+			method = &ConfirmSelectOk{}
+		}
 	default:
 		return nil, fmt.Errorf("Bad class or method id!. Class id: %d, Method id: %d", mf.ClassID, mf.MethodID)
 
@@ -0,0 +1,162 @@
+package proto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// encodeFrame returns the frame as written on the wire
+func encodeFrame(t *testing.T, f Frame) []byte {
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// frameErrCode returns the code of a protocol error, or zero for other errors
+func frameErrCode(err error) uint16 {
+	if pErr, ok := err.(*Error); ok {
+		return pErr.Code
+	}
+	return 0
+}
+
+func TestReadFrameFrameMax(t *testing.T) {
+	const frameMax = FrameMinSize
+
+	tests := []struct {
+		name     string
+		size     int
+		frameMax uint32
+		wantErr  bool
+	}{
+		{"well within", 10, frameMax, false},
+		{"exactly frame max", frameMax - FrameOverhead, frameMax, false},
+		{"one over frame max", frameMax - FrameOverhead + 1, frameMax, true},
+		{"far over frame max", 10 * frameMax, frameMax, true},
+		{"no limit", 10 * frameMax, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := bytes.Repeat([]byte{'x'}, tt.size)
+			encoded := encodeFrame(t, &BodyFrame{ChannelID: 1, Body: body})
+			src := bytes.NewReader(encoded)
+
+			frame, err := Reader{R: src, FrameMax: tt.frameMax}.ReadFrame()
+			if tt.wantErr {
+				if frameErrCode(err) != FrameErr {
+					t.Fatalf("got error %v, want a frame error", err)
+				}
+				// Only the frame header is read from an oversized frame
+				if read := len(encoded) - src.Len(); read != 7 {
+					t.Errorf("read %d bytes of an oversized frame, want 7", read)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadFrame: %v", err)
+			}
+			bf, ok := frame.(*BodyFrame)
+			if !ok {
+				t.Fatalf("got %T, want *BodyFrame", frame)
+			}
+			if !bytes.Equal(bf.Body, body) {
+				t.Error("body differs after reading")
+			}
+		})
+	}
+}
+
+func TestReadFrameHugeSizeHeader(t *testing.T) {
+	// A header claiming a 4 GB payload, with no payload following
+	var hdr [7]byte
+	hdr[0] = FrameBody
+	binary.BigEndian.PutUint16(hdr[1:3], 1)
+	binary.BigEndian.PutUint32(hdr[3:7], 0xFFFFFFF0)
+
+	_, err := Reader{R: bytes.NewReader(hdr[:]), FrameMax: FrameMinSize}.ReadFrame()
+	if frameErrCode(err) != FrameErr {
+		t.Errorf("got error %v, want a frame error", err)
+	}
+
+	// Without a limit the missing payload is reported, not allocated
+	_, err = Reader{R: bytes.NewReader(hdr[:])}.ReadFrame()
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("got error %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestReadFrameBodiesSplitByBodyFrames(t *testing.T) {
+	const frameMax = FrameMinSize
+	body := bytes.Repeat([]byte("abc"), frameMax)
+
+	var wire bytes.Buffer
+	for _, f := range BodyFrames(3, body, frameMax) {
+		if err := f.Write(&wire); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	r := Reader{R: &wire, FrameMax: frameMax}
+	var joined []byte
+	for wire.Len() > 0 {
+		frame, err := r.ReadFrame()
+		if err != nil {
+			t.Fatalf("ReadFrame: %v", err)
+		}
+		joined = append(joined, frame.(*BodyFrame).Body...)
+	}
+	if !bytes.Equal(joined, body) {
+		t.Error("frames read do not join back into the body")
+	}
+}
+
+func TestReadFrameHeartbeat(t *testing.T) {
+	encoded := encodeFrame(t, &HeartbeatFrame{})
+	frame, err := Reader{R: bytes.NewReader(encoded), FrameMax: FrameMinSize}.ReadFrame()
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if _, ok := frame.(*HeartbeatFrame); !ok {
+		t.Errorf("got %T, want *HeartbeatFrame", frame)
+	}
+
+	// Heartbeats are only valid on channel 0
+	binary.BigEndian.PutUint16(encoded[1:3], 5)
+	if _, err := (Reader{R: bytes.NewReader(encoded)}).ReadFrame(); frameErrCode(err) != FrameErr {
+		t.Errorf("got error %v for a heartbeat on channel 5, want a frame error", err)
+	}
+}
+
+func TestReadFrameMalformed(t *testing.T) {
+	valid := encodeFrame(t, &BodyFrame{ChannelID: 1, Body: []byte("body")})
+
+	badEnd := append([]byte{}, valid...)
+	badEnd[len(badEnd)-1] = 0
+
+	badType := append([]byte{}, valid...)
+	badType[0] = 99
+
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{"bad frame end", badEnd},
+		{"unknown frame type", badType},
+		{"truncated header", valid[:5]},
+		{"truncated payload", valid[:9]},
+		{"missing frame end", valid[:len(valid)-1]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := (Reader{R: bytes.NewReader(tt.input)}).ReadFrame(); err == nil {
+				t.Error("ReadFrame succeeded, want an error")
+			}
+		})
+	}
+}
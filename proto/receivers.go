@@ -278,6 +278,116 @@ func (f *ConnectionCloseOk) Write(w io.Writer) (err error) {
 	return
 }
 
+// ** ConnectionTune **
+
+// Identifier returns the class ID and method ID
+func (f *ConnectionTune) Identifier() (uint16, uint16) {
+	return 10, 40
+}
+
+// MethodName returns a the name of the Method
+func (f *ConnectionTune) MethodName() string {
+	return "ConnectionTune"
+}
+
+// FrameType returns the frame type of the method
+func (f *ConnectionTune) FrameType() byte {
+	return 1
+}
+
+// Wait returns a boolean signifying if the method need any wait
+func (f *ConnectionTune) Wait() bool {
+	return true
+}
+
+func (f *ConnectionTune) Read(r io.Reader) (err error) {
+	f.ChannelMax, err = ReadShort(r)
+	if err != nil {
+		return errors.New("could not read channel max in ConnectionTune: " + err.Error())
+	}
+
+	f.FrameMax, err = ReadLong(r)
+	if err != nil {
+		return errors.New("could not read frame max in ConnectionTune: " + err.Error())
+	}
+
+	f.Heartbeat, err = ReadShort(r)
+	if err != nil {
+		return errors.New("could not read heartbeat in ConnectionTune: " + err.Error())
+	}
+	return
+}
+
+func (f *ConnectionTune) Write(w io.Writer) (err error) {
+	if err = WriteShort(w, f.ChannelMax); err != nil {
+		return errors.New("could not write ChannelMax in ConnectionTune: " + err.Error())
+	}
+
+	if err = WriteLong(w, f.FrameMax); err != nil {
+		return errors.New("could not write FrameMax in ConnectionTune: " + err.Error())
+	}
+
+	if err = WriteShort(w, f.Heartbeat); err != nil {
+		return errors.New("could not write Heartbeat in ConnectionTune: " + err.Error())
+	}
+	return
+}
+
+// ** ConnectionTuneOk **
+
+// Identifier returns the class ID and method ID
+func (f *ConnectionTuneOk) Identifier() (uint16, uint16) {
+	return 10, 41
+}
+
+// MethodName returns a the name of the Method
+func (f *ConnectionTuneOk) MethodName() string {
+	return "ConnectionTuneOk"
+}
+
+// FrameType returns the frame type of the method
+func (f *ConnectionTuneOk) FrameType() byte {
+	return 1
+}
+
+// Wait returns a boolean signifying if the method need any wait
+func (f *ConnectionTuneOk) Wait() bool {
+	return false
+}
+
+func (f *ConnectionTuneOk) Read(r io.Reader) (err error) {
+	f.ChannelMax, err = ReadShort(r)
+	if err != nil {
+		return errors.New("could not read channel max in ConnectionTuneOk: " + err.Error())
+	}
+
+	f.FrameMax, err = ReadLong(r)
+	if err != nil {
+		return errors.New("could not read frame max in ConnectionTuneOk: " + err.Error())
+	}
+
+	f.Heartbeat, err = ReadShort(r)
+	if err != nil {
+		return errors.New("could not read heartbeat in ConnectionTuneOk: " + err.Error())
+	}
+	return
+}
+
+func (f *ConnectionTuneOk) Write(w io.Writer) (err error) {
+	if err = WriteShort(w, f.ChannelMax); err != nil {
+		return errors.New("could not write ChannelMax in ConnectionTuneOk: " + err.Error())
+	}
+
+	if err = WriteLong(w, f.FrameMax); err != nil {
+		return errors.New("could not write FrameMax in ConnectionTuneOk: " + err.Error())
+	}
+
+	if err = WriteShort(w, f.Heartbeat); err != nil {
+		return errors.New("could not write Heartbeat in ConnectionTuneOk: " + err.Error())
+	}
+	return
+}
+
 // *******************
 //    CHANNEL SPECS
 // *******************
@@ -582,6 +692,13 @@ func (f *ExchangeDeclare) Read(r io.Reader) (err error) {
 		return errors.New("could not read bits in ExchangeDeclare: " + err.Error())
 	}
 	f.NoWait = (bits&(1<<0) > 0)
+	f.Durable = (bits&(1<<1) > 0)
+	f.Passive = (bits&(1<<2) > 0)
+
+	f.Arguments, err = ReadTable(r)
+	if err != nil {
+		return errors.New("could not read arguments in ExchangeDeclare: " + err.Error())
+	}
 
 	return
 }
@@ -604,9 +721,21 @@ func (f *ExchangeDeclare) Write(w io.Writer) (err error) {
 		bits |= 1 << 0
 	}
 
+	if f.Durable {
+		bits |= 1 << 1
+	}
+
+	if f.Passive {
+		bits |= 1 << 2
+	}
+
 	if err = WriteOctet(w, bits); err != nil {
 		return errors.New("could not write bits in ExchangeDeclare: " + err.Error())
 	}
+
+	if err = WriteTable(w, f.Arguments); err != nil {
+		return errors.New("could not write arguments in ExchangeDeclare: " + err.Error())
+	}
 	return nil
 }
 
@@ -633,11 +762,27 @@ func (f *ExchangeDeclareOk) Wait() bool {
 }
 
 func (f *ExchangeDeclareOk) Read(r io.Reader) (err error) {
+	f.BindingCnt, err = ReadLong(r)
+	if err != nil {
+		return errors.New("could not read BindingCnt in ExchangeDeclareOk: " + err.Error())
+	}
+
+	f.ScheduledCnt, err = ReadLong(r)
+	if err != nil {
+		return errors.New("could not read ScheduledCnt in ExchangeDeclareOk: " + err.Error())
+	}
 	return
 }
 
 func (f *ExchangeDeclareOk) Write(w io.Writer) (err error) {
 
+	if err = WriteLong(w, f.BindingCnt); err != nil {
+		return errors.New("could not write BindingCnt in ExchangeDeclareOk: " + err.Error())
+	}
+
+	if err = WriteLong(w, f.ScheduledCnt); err != nil {
+		return errors.New("could not write ScheduledCnt in ExchangeDeclareOk: " + err.Error())
+	}
 	return
 }
 
@@ -778,6 +923,11 @@ func (f *ExchangeBind) Read(r io.Reader) (err error) {
 
 	f.NoWait = (bits&(1<<0) > 0)
 
+	f.Arguments, err = ReadTable(r)
+	if err != nil {
+		return errors.New("could not read arguments in ExchangeBind: " + err.Error())
+	}
+
 	return
 }
 
@@ -804,6 +954,10 @@ func (f *ExchangeBind) Write(w io.Writer) (err error) {
 	if err = WriteOctet(w, bits); err != nil {
 		return errors.New("could not write bits in ExchangeBind: " + err.Error())
 	}
+
+	if err = WriteTable(w, f.Arguments); err != nil {
+		return errors.New("could not write arguments in ExchangeBind: " + err.Error())
+	}
 	return
 }
 
@@ -883,6 +1037,11 @@ func (f *ExchangeUnbind) Read(r io.Reader) (err error) {
 
 	f.NoWait = (bits&(1<<0) > 0)
 
+	f.Arguments, err = ReadTable(r)
+	if err != nil {
+		return errors.New("could not read arguments in ExchangeUnbind: " + err.Error())
+	}
+
 	return
 }
 
@@ -909,6 +1068,10 @@ func (f *ExchangeUnbind) Write(w io.Writer) (err error) {
 	if err = WriteOctet(w, bits); err != nil {
 		return errors.New("could not write bits in ExchangeUnbind: " + err.Error())
 	}
+
+	if err = WriteTable(w, f.Arguments); err != nil {
+		return errors.New("could not write arguments in ExchangeUnbind: " + err.Error())
+	}
 	return
 }
 
@@ -953,6 +1116,8 @@ func (f *ExchangeUnbindOk) Write(w io.Writer) (err error) {
 //        QueueUnbindOk  - 31
 //        QueueDelete    - 40
 //        QueueDeleteOk  - 41
+//        QueuePurge     - 50
+//        QueuePurgeOk   - 51
 // *******************
 
 // **QueueDeclare**
@@ -988,6 +1153,15 @@ func (f *QueueDeclare) Read(r io.Reader) (err error) {
 		return errors.New("could not read bits in QueueDeclare: " + err.Error())
 	}
 	f.NoWait = (bits&(1<<0) > 0)
+	f.Durable = (bits&(1<<1) > 0)
+	f.Exclusive = (bits&(1<<2) > 0)
+	f.AutoDelete = (bits&(1<<3) > 0)
+	f.Passive = (bits&(1<<4) > 0)
+
+	f.Arguments, err = ReadTable(r)
+	if err != nil {
+		return errors.New("could not read arguments in QueueDeclare: " + err.Error())
+	}
 
 	return
 }
@@ -1003,9 +1177,29 @@ func (f *QueueDeclare) Write(w io.Writer) (err error) {
 		bits |= 1 << 0
 	}
 
+	if f.Durable {
+		bits |= 1 << 1
+	}
+
+	if f.Exclusive {
+		bits |= 1 << 2
+	}
+
+	if f.AutoDelete {
+		bits |= 1 << 3
+	}
+
+	if f.Passive {
+		bits |= 1 << 4
+	}
+
 	if err = WriteOctet(w, bits); err != nil {
 		return errors.New("could not write bits in QueueDeclare: " + err.Error())
 	}
+
+	if err = WriteTable(w, f.Arguments); err != nil {
+		return errors.New("could not write arguments in QueueDeclare: " + err.Error())
+	}
 	return
 }
 
@@ -1111,6 +1305,11 @@ func (f *QueueBind) Read(r io.Reader) (err error) {
 	}
 	f.NoWait = (bits&(1<<0) > 0)
 
+	f.Arguments, err = ReadTable(r)
+	if err != nil {
+		return errors.New("could not read arguments in QueueBind: " + err.Error())
+	}
+
 	return
 }
 
@@ -1139,6 +1338,10 @@ func (f *QueueBind) Write(w io.Writer) (err error) {
 	if err = WriteOctet(w, bits); err != nil {
 		return errors.New("could not write bits in QueueBind: " + err.Error())
 	}
+
+	if err = WriteTable(w, f.Arguments); err != nil {
+		return errors.New("could not write Arguments in QueueBind: " + err.Error())
+	}
 	return
 }
 
@@ -1211,6 +1414,11 @@ func (f *QueueUnbind) Read(r io.Reader) (err error) {
 		return errors.New("could not read routingkey in QueueUnbind: " + err.Error())
 	}
 
+	f.Arguments, err = ReadTable(r)
+	if err != nil {
+		return errors.New("could not read arguments in QueueUnbind: " + err.Error())
+	}
+
 	return
 }
 
@@ -1227,6 +1435,10 @@ func (f *QueueUnbind) Write(w io.Writer) (err error) {
 	if err = WriteLongStr(w, f.RoutingKey); err != nil {
 		return errors.New("could not write Exchange in QueueUnbind: " + err.Error())
 	}
+
+	if err = WriteTable(w, f.Arguments); err != nil {
+		return errors.New("could not write Arguments in QueueUnbind: " + err.Error())
+	}
 	return
 }
 
@@ -1363,6 +1575,100 @@ func (f *QueueDeleteOk) Write(w io.Writer) (err error) {
 	return
 }
 
+// **QueuePurge**
+
+// Identifier returns the class ID and method ID
+func (f *QueuePurge) Identifier() (uint16, uint16) {
+	return 40, 50
+}
+
+// MethodName returns a the name of the Method
+func (f *QueuePurge) MethodName() string {
+	return "QueuePurge"
+}
+
+// FrameType returns the frame type of the method
+func (f *QueuePurge) FrameType() byte {
+	return 1
+}
+
+// Wait returns a boolean signifying if the method need any wait
+func (f *QueuePurge) Wait() bool {
+	return true && !f.NoWait
+}
+
+func (f *QueuePurge) Read(r io.Reader) (err error) {
+	f.Queue, err = ReadLongStr(r)
+	if err != nil {
+		return errors.New("could not read queue name in QueuePurge: " + err.Error())
+	}
+
+	bits, err := ReadOctet(r)
+	if err != nil {
+		return errors.New("could not read bits in QueuePurge: " + err.Error())
+	}
+	f.NoWait = (bits&(1<<0) > 0)
+
+	return
+}
+
+func (f *QueuePurge) Write(w io.Writer) (err error) {
+
+	if err = WriteLongStr(w, f.Queue); err != nil {
+		return errors.New("could not write Queue in QueuePurge: " + err.Error())
+	}
+
+	var bits byte
+
+	if f.NoWait {
+		bits |= 1 << 0
+	}
+
+	if err = WriteOctet(w, bits); err != nil {
+		return errors.New("could not write bits in QueuePurge: " + err.Error())
+	}
+	return
+}
+
+// **QueuePurgeOk**
+
+// Identifier returns the class ID and method ID
+func (f *QueuePurgeOk) Identifier() (uint16, uint16) {
+	return 40, 51
+}
+
+// MethodName returns a the name of the Method
+func (f *QueuePurgeOk) MethodName() string {
+	return "QueuePurgeOk"
+}
+
+// FrameType returns the frame type of the method
+func (f *QueuePurgeOk) FrameType() byte {
+	return 1
+}
+
+// Wait returns a boolean signifying if the method need any wait
+func (f *QueuePurgeOk) Wait() bool {
+	return true
+}
+
+func (f *QueuePurgeOk) Read(r io.Reader) (err error) {
+	f.MessageCnt, err = ReadLong(r)
+	if err != nil {
+		return errors.New("could not read MessageCnt in QueuePurgeOk: " + err.Error())
+	}
+
+	return
+}
+
+func (f *QueuePurgeOk) Write(w io.Writer) (err error) {
+
+	if err = WriteLong(w, f.MessageCnt); err != nil {
+		return errors.New("could not write MessageCnt in QueuePurgeOk: " + err.Error())
+	}
+	return
+}
+
 // *******************
 //    QoS SPECS
 //        basicConsume - 10
@@ -1374,6 +1680,11 @@ func (f *QueueDeleteOk) Write(w io.Writer) (err error) {
 //        basicDeliver - 50
 //        basicAck     - 60
 //        basicNack    - 70
+//        basicGet     - 80
+//        basicGetOk   - 81
+//        basicGetEmpty - 82
+//        basicQos     - 90
+//        basicQosOk   - 91
 // *******************
 
 // ** BasicConsume **
@@ -1417,6 +1728,11 @@ func (f *BasicConsume) Read(r io.Reader) (err error) {
 	f.NoAck = (bits&(1<<0) > 0)
 	f.NoWait = (bits&(1<<1) > 0)
 
+	f.Arguments, err = ReadTable(r)
+	if err != nil {
+		return errors.New("could not read arguments in basicConsume: " + err.Error())
+	}
+
 	return
 }
 
@@ -1442,6 +1758,10 @@ func (f *BasicConsume) Write(w io.Writer) (err error) {
 	if err = WriteOctet(w, bits); err != nil {
 		return errors.New("could not write bits in BasicConsume: " + err.Error())
 	}
+
+	if err = WriteTable(w, f.Arguments); err != nil {
+		return errors.New("could not write arguments in BasicConsume: " + err.Error())
+	}
 	return
 }
 
@@ -1627,6 +1947,7 @@ func (f *BasicPublish) Read(r io.Reader) (err error) {
 	}
 
 	f.Immediate = (bits&(1<<0) > 0)
+	f.Mandatory = (bits&(1<<1) > 0)
 
 	return
 }
@@ -1647,6 +1968,10 @@ func (f *BasicPublish) Write(w io.Writer) (err error) {
 		bits |= 1 << 0
 	}
 
+	if f.Mandatory {
+		bits |= 1 << 1
+	}
+
 	if err = WriteOctet(w, bits); err != nil {
 		return errors.New("could not write bits in BasicPublish: " + err.Error())
 	}
@@ -1772,6 +2097,13 @@ func (f *BasicDeliver) Read(r io.Reader) (err error) {
 		return errors.New("could not read exchange name in BasicDeliver: " + err.Error())
 	}
 
+	bits, err := ReadOctet(r)
+	if err != nil {
+		return errors.New("could not read bits in BasicDeliver: " + err.Error())
+	}
+
+	f.Redelivered = (bits&(1<<0) > 0)
+
 	f.Exchange, err = ReadLongStr(r)
 	if err != nil {
 		return errors.New("could not read exchange name in BasicDeliver: " + err.Error())
@@ -1795,6 +2127,15 @@ func (f *BasicDeliver) Write(w io.Writer) (err error) {
 		return errors.New("could not write ReplyText in BasicDeliver: " + err.Error())
 	}
 
+	var bits byte
+	if f.Redelivered {
+		bits |= 1 << 0
+	}
+
+	if err = WriteOctet(w, bits); err != nil {
+		return errors.New("could not write bits in BasicDeliver: " + err.Error())
+	}
+
 	if err = WriteLongStr(w, f.Exchange); err != nil {
 		return errors.New("could not write Exchange in BasicDeliver: " + err.Error())
 	}
@@ -1919,6 +2260,277 @@ func (f *BasicNack) Write(w io.Writer) (err error) {
 	return
 }
 
+// ** BasicGet **
+
+// Identifier returns the class ID and method ID
+func (f *BasicGet) Identifier() (uint16, uint16) {
+	return 50, 80
+}
+
+// MethodName returns a the name of the Method
+func (f *BasicGet) MethodName() string {
+	return "BasicGet"
+}
+
+// FrameType returns the frame type of the method
+func (f *BasicGet) FrameType() byte {
+	return 1
+}
+
+// Wait returns a boolean signifying if the method need any wait
+func (f *BasicGet) Wait() bool {
+	return true
+}
+
+func (f *BasicGet) Read(r io.Reader) (err error) {
+	f.Queue, err = ReadLongStr(r)
+	if err != nil {
+		return errors.New("could not read queue name in BasicGet: " + err.Error())
+	}
+
+	bits, err := ReadOctet(r)
+	if err != nil {
+		return errors.New("could not read bits in BasicGet: " + err.Error())
+	}
+
+	f.NoAck = (bits&(1<<0) > 0)
+
+	return
+}
+
+func (f *BasicGet) Write(w io.Writer) (err error) {
+
+	if err = WriteLongStr(w, f.Queue); err != nil {
+		return errors.New("could not write Queue in BasicGet: " + err.Error())
+	}
+
+	var bits byte
+	if f.NoAck {
+		bits |= 1 << 0
+	}
+
+	if err = WriteOctet(w, bits); err != nil {
+		return errors.New("could not write bits in BasicGet: " + err.Error())
+	}
+	return
+}
+
+// ** BasicGetOk **
+
+// Identifier returns the class ID and method ID
+func (f *BasicGetOk) Identifier() (uint16, uint16) {
+	return 50, 81
+}
+
+// MethodName returns a the name of the Method
+func (f *BasicGetOk) MethodName() string {
+	return "BasicGetOk"
+}
+
+// FrameType returns the frame type of the method
+func (f *BasicGetOk) FrameType() byte {
+	return 1
+}
+
+// Wait returns a boolean signifying if the method need any wait
+func (f *BasicGetOk) Wait() bool {
+	return true
+}
+
+// GetContent gets the method frame body
+func (f *BasicGetOk) GetContent() (Properties, []byte) {
+	return f.Properties, f.Body
+}
+
+// SetContent sets the method frame body
+func (f *BasicGetOk) SetContent(p Properties, b []byte) {
+	f.Properties, f.Body = p, b
+}
+
+func (f *BasicGetOk) Read(r io.Reader) (err error) {
+	f.DeliveryTag, err = ReadLongLong(r)
+	if err != nil {
+		return errors.New("could not read delivery tag in BasicGetOk: " + err.Error())
+	}
+
+	bits, err := ReadOctet(r)
+	if err != nil {
+		return errors.New("could not read bits in BasicGetOk: " + err.Error())
+	}
+
+	f.Redelivered = (bits&(1<<0) > 0)
+
+	f.Exchange, err = ReadLongStr(r)
+	if err != nil {
+		return errors.New("could not read exchange name in BasicGetOk: " + err.Error())
+	}
+
+	f.RoutingKey, err = ReadLongStr(r)
+	if err != nil {
+		return errors.New("could not read routing key in BasicGetOk: " + err.Error())
+	}
+
+	f.MessageCount, err = ReadLong(r)
+	if err != nil {
+		return errors.New("could not read message count in BasicGetOk: " + err.Error())
+	}
+
+	return
+}
+
+func (f *BasicGetOk) Write(w io.Writer) (err error) {
+
+	if err = WriteLongLong(w, f.DeliveryTag); err != nil {
+		return errors.New("could not write DeliveryTag in BasicGetOk: " + err.Error())
+	}
+
+	var bits byte
+	if f.Redelivered {
+		bits |= 1 << 0
+	}
+
+	if err = WriteOctet(w, bits); err != nil {
+		return errors.New("could not write bits in BasicGetOk: " + err.Error())
+	}
+
+	if err = WriteLongStr(w, f.Exchange); err != nil {
+		return errors.New("could not write Exchange in BasicGetOk: " + err.Error())
+	}
+
+	if err = WriteLongStr(w, f.RoutingKey); err != nil {
+		return errors.New("could not write RoutingKey in BasicGetOk: " + err.Error())
+	}
+
+	if err = WriteLong(w, f.MessageCount); err != nil {
+		return errors.New("could not write MessageCount in BasicGetOk: " + err.Error())
+	}
+	return
+}
+
+// ** BasicGetEmpty **
+
+// Identifier returns the class ID and method ID
+func (f *BasicGetEmpty) Identifier() (uint16, uint16) {
+	return 50, 82
+}
+
+// MethodName returns a the name of the Method
+func (f *BasicGetEmpty) MethodName() string {
+	return "BasicGetEmpty"
+}
+
+// FrameType returns the frame type of the method
+func (f *BasicGetEmpty) FrameType() byte {
+	return 1
+}
+
+// Wait returns a boolean signifying if the method need any wait
+func (f *BasicGetEmpty) Wait() bool {
+	return true
+}
+
+func (f *BasicGetEmpty) Read(r io.Reader) (err error) {
+	return
+}
+
+func (f *BasicGetEmpty) Write(w io.Writer) (err error) {
+	return
+}
+
+// ** BasicQos **
+
+// Identifier returns the class ID and method ID
+func (f *BasicQos) Identifier() (uint16, uint16) {
+	return 50, 90
+}
+
+// MethodName returns a the name of the Method
+func (f *BasicQos) MethodName() string {
+	return "BasicQos"
+}
+
+// FrameType returns the frame type of the method
+func (f *BasicQos) FrameType() byte {
+	return 1
+}
+
+// Wait returns a boolean signifying if the method need any wait
+func (f *BasicQos) Wait() bool {
+	return true
+}
+
+func (f *BasicQos) Read(r io.Reader) (err error) {
+	f.PrefetchSize, err = ReadLong(r)
+	if err != nil {
+		return errors.New("could not read prefetch size in BasicQos: " + err.Error())
+	}
+
+	f.PrefetchCount, err = ReadShort(r)
+	if err != nil {
+		return errors.New("could not read prefetch count in BasicQos: " + err.Error())
+	}
+
+	bits, err := ReadOctet(r)
+	if err != nil {
+		return errors.New("could not read bits in BasicQos: " + err.Error())
+	}
+
+	f.Global = (bits&(1<<0) > 0)
+
+	return
+}
+
+func (f *BasicQos) Write(w io.Writer) (err error) {
+
+	if err = WriteLong(w, f.PrefetchSize); err != nil {
+		return errors.New("could not write PrefetchSize in BasicQos: " + err.Error())
+	}
+
+	if err = WriteShort(w, f.PrefetchCount); err != nil {
+		return errors.New("could not write PrefetchCount in BasicQos: " + err.Error())
+	}
+
+	var bits byte
+	if f.Global {
+		bits |= 1 << 0
+	}
+
+	if err = WriteOctet(w, bits); err != nil {
+		return errors.New("could not write bits in BasicQos: " + err.Error())
+	}
+	return
+}
+
+// ** BasicQosOk **
+
+// Identifier returns the class ID and method ID
+func (f *BasicQosOk) Identifier() (uint16, uint16) {
+	return 50, 91
+}
+
+// MethodName returns a the name of the Method
+func (f *BasicQosOk) MethodName() string {
+	return "BasicQosOk"
+}
+
+// FrameType returns the frame type of the method
+func (f *BasicQosOk) FrameType() byte {
+	return 1
+}
+
+// Wait returns a boolean signifying if the method need any wait
+func (f *BasicQosOk) Wait() bool {
+	return true
+}
+
+func (f *BasicQosOk) Read(r io.Reader) (err error) {
+	return
+}
+
+func (f *BasicQosOk) Write(w io.Writer) (err error) {
+	return
+}
+
 // *******************
 //   Tx SPECS
 //   Class - 60
@@ -2109,3 +2721,86 @@ func (f *TxRollbackOk) Read(r io.Reader) (err error) {
 func (f *TxRollbackOk) Write(w io.Writer) (err error) {
 	return
 }
+
+// *******************
+//   Confirm SPECS
+//   Class - 85
+//	 ConfirmSelect - 10
+//	 ConfirmSelectOk - 11
+// *******************
+
+// ** ConfirmSelect **
+
+// Identifier returns the class ID and method ID
+func (f *ConfirmSelect) Identifier() (uint16, uint16) {
+	return 85, 10
+}
+
+// MethodName returns a the name of the Method
+func (f *ConfirmSelect) MethodName() string {
+	return "ConfirmSelect"
+}
+
+// FrameType returns the frame type of the method
+func (f *ConfirmSelect) FrameType() byte {
+	return 1
+}
+
+// Wait returns a boolean signifying if the method need any wait
+func (f *ConfirmSelect) Wait() bool {
+	return true && !f.NoWait
+}
+
+func (f *ConfirmSelect) Read(r io.Reader) (err error) {
+	bits, err := ReadOctet(r)
+	if err != nil {
+		return errors.New("could not read bits in ConfirmSelect: " + err.Error())
+	}
+
+	f.NoWait = (bits&(1<<0) > 0)
+
+	return
+}
+
+func (f *ConfirmSelect) Write(w io.Writer) (err error) {
+
+	var bits byte
+	if f.NoWait {
+		bits |= 1 << 0
+	}
+
+	if err = WriteOctet(w, bits); err != nil {
+		return errors.New("could not write bits in ConfirmSelect: " + err.Error())
+	}
+	return
+}
+
+// ** ConfirmSelectOk **
+
+// Identifier returns the class ID and method ID
+func (f *ConfirmSelectOk) Identifier() (uint16, uint16) {
+	return 85, 11
+}
+
+// MethodName returns a the name of the Method
+func (f *ConfirmSelectOk) MethodName() string {
+	return "ConfirmSelectOk"
+}
+
+// FrameType returns the frame type of the method
+func (f *ConfirmSelectOk) FrameType() byte {
+	return 1
+}
+
+// Wait returns a boolean signifying if the method need any wait
+func (f *ConfirmSelectOk) Wait() bool {
+	return true
+}
+
+func (f *ConfirmSelectOk) Read(r io.Reader) (err error) {
+	return
+}
+
+func (f *ConfirmSelectOk) Write(w io.Writer) (err error) {
+	return
+}
@@ -37,6 +37,20 @@ type ConnectionClose struct {
 // ConnectionCloseOk struct
 type ConnectionCloseOk struct{}
 
+// ConnectionTune struct
+type ConnectionTune struct {
+	ChannelMax uint16
+	FrameMax   uint32
+	Heartbeat  uint16
+}
+
+// ConnectionTuneOk struct
+type ConnectionTuneOk struct {
+	ChannelMax uint16
+	FrameMax   uint32
+	Heartbeat  uint16
+}
+
 // ***********************
 //      CHANNEL FRAMES
 // ***********************
@@ -78,13 +92,19 @@ type ChannelCloseOk struct{}
 
 // ExchangeDeclare struct
 type ExchangeDeclare struct {
-	Exchange string
-	Type     string
-	NoWait   bool
+	Exchange  string
+	Type      string
+	Durable   bool
+	NoWait    bool
+	Passive   bool
+	Arguments Table
 }
 
 // ExchangeDeclareOk struct
-type ExchangeDeclareOk struct{}
+type ExchangeDeclareOk struct {
+	BindingCnt   uint32
+	ScheduledCnt uint32
+}
 
 // ExchangeDelete struct
 type ExchangeDelete struct {
@@ -102,6 +122,7 @@ type ExchangeBind struct {
 	Source      string
 	RoutingKey  string
 	NoWait      bool
+	Arguments   Table
 }
 
 // ExchangeBindOk struct
@@ -113,6 +134,7 @@ type ExchangeUnbind struct {
 	Source      string
 	RoutingKey  string
 	NoWait      bool
+	Arguments   Table
 }
 
 // ExchangeUnbindOk struct
@@ -124,8 +146,13 @@ type ExchangeUnbindOk struct{}
 
 // QueueDeclare struct
 type QueueDeclare struct {
-	Queue  string
-	NoWait bool
+	Queue      string
+	Durable    bool
+	Exclusive  bool
+	AutoDelete bool
+	NoWait     bool
+	Passive    bool
+	Arguments  Table
 }
 
 // QueueDeclareOk struct
@@ -141,6 +168,7 @@ type QueueBind struct {
 	Exchange   string
 	RoutingKey string
 	NoWait     bool
+	Arguments  Table
 }
 
 // QueueBindOk struct
@@ -151,6 +179,7 @@ type QueueUnbind struct {
 	Queue      string
 	Exchange   string
 	RoutingKey string
+	Arguments  Table
 }
 
 // QueueUnbindOk struct
@@ -169,6 +198,17 @@ type QueueDeleteOk struct {
 	MessageCnt uint32
 }
 
+// QueuePurge struct
+type QueuePurge struct {
+	Queue  string
+	NoWait bool
+}
+
+// QueuePurgeOk struct
+type QueuePurgeOk struct {
+	MessageCnt uint32
+}
+
 // ***********************
 //     BASIC FRAMES
 // ***********************
@@ -179,6 +219,7 @@ type BasicConsume struct {
 	ConsumerTag string
 	NoAck       bool
 	NoWait      bool
+	Arguments   Table
 }
 
 // BasicConsumeOk struct
@@ -201,6 +242,7 @@ type BasicCancelOk struct {
 type BasicPublish struct {
 	Exchange   string
 	RoutingKey string
+	Mandatory  bool
 	Immediate  bool
 	Properties Properties
 	Body       []byte
@@ -220,6 +262,7 @@ type BasicReturn struct {
 type BasicDeliver struct {
 	ConsumerTag string
 	DeliveryTag uint64
+	Redelivered bool
 	Exchange    string
 	RoutingKey  string
 	Properties  Properties
@@ -239,6 +282,36 @@ type BasicNack struct {
 	Requeue     bool
 }
 
+// BasicQos struct
+type BasicQos struct {
+	PrefetchSize  uint32
+	PrefetchCount uint16
+	Global        bool
+}
+
+// BasicQosOk struct
+type BasicQosOk struct{}
+
+// BasicGet struct
+type BasicGet struct {
+	Queue string
+	NoAck bool
+}
+
+// BasicGetOk struct
+type BasicGetOk struct {
+	DeliveryTag  uint64
+	Redelivered  bool
+	Exchange     string
+	RoutingKey   string
+	MessageCount uint32
+	Properties   Properties
+	Body         []byte
+}
+
+// BasicGetEmpty struct
+type BasicGetEmpty struct{}
+
 // ***********************
 //    	TX FRAMES
 // ***********************
@@ -260,3 +333,15 @@ type TxRollback struct{}
 
 // TxRollbackOk struct
 type TxRollbackOk struct{}
+
+// ***********************
+//    	CONFIRM FRAMES
+// ***********************
+
+// ConfirmSelect struct
+type ConfirmSelect struct {
+	NoWait bool
+}
+
+// ConfirmSelectOk struct
+type ConfirmSelectOk struct{}
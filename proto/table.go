@@ -0,0 +1,343 @@
+package proto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// Table struct holds field names against their values.
+// Supported value types are bool, int8, uint8, int16, uint16, int32,
+// uint32, int64, float32, float64, string, []byte, time.Time, Table,
+// []interface{} of supported values and nil.
+// Values of type int are written as int64.
+type Table map[string]interface{}
+
+// Field value types
+const (
+	fieldBool        = 't'
+	fieldShortShort  = 'b'
+	fieldShortShortU = 'B'
+	fieldShortInt    = 's'
+	fieldShortIntU   = 'u'
+	fieldLongInt     = 'I'
+	fieldLongIntU    = 'i'
+	fieldLongLong    = 'l'
+	fieldFloat       = 'f'
+	fieldDouble      = 'd'
+	fieldLongStr     = 'S'
+	fieldBytes       = 'x'
+	fieldTimestamp   = 'T'
+	fieldTable       = 'F'
+	fieldArray       = 'A'
+	fieldVoid        = 'V'
+)
+
+// WriteTable writes a field table, prefixed with its size
+func WriteTable(w io.Writer, t Table) error {
+	var payload bytes.Buffer
+
+	// Sort keys, so that equal tables are always written the same way
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err := WriteShortStr(&payload, k); err != nil {
+			return err
+		}
+		if err := writeField(&payload, t[k]); err != nil {
+			return fmt.Errorf("could not write field %s: %s", k, err.Error())
+		}
+	}
+
+	return WriteLongStr(w, payload.String())
+}
+
+func writeField(w io.Writer, value interface{}) (err error) {
+	switch v := value.(type) {
+
+	case bool:
+		var b byte
+		if v {
+			b = 1
+		}
+		if err = WriteOctet(w, fieldBool); err == nil {
+			err = WriteOctet(w, b)
+		}
+
+	case int8:
+		if err = WriteOctet(w, fieldShortShort); err == nil {
+			err = WriteOctet(w, uint8(v))
+		}
+
+	case uint8:
+		if err = WriteOctet(w, fieldShortShortU); err == nil {
+			err = WriteOctet(w, v)
+		}
+
+	case int16:
+		if err = WriteOctet(w, fieldShortInt); err == nil {
+			err = WriteShort(w, uint16(v))
+		}
+
+	case uint16:
+		if err = WriteOctet(w, fieldShortIntU); err == nil {
+			err = WriteShort(w, v)
+		}
+
+	case int32:
+		if err = WriteOctet(w, fieldLongInt); err == nil {
+			err = WriteLong(w, uint32(v))
+		}
+
+	case uint32:
+		if err = WriteOctet(w, fieldLongIntU); err == nil {
+			err = WriteLong(w, v)
+		}
+
+	case int:
+		if err = WriteOctet(w, fieldLongLong); err == nil {
+			err = WriteLongLong(w, uint64(v))
+		}
+
+	case int64:
+		if err = WriteOctet(w, fieldLongLong); err == nil {
+			err = WriteLongLong(w, uint64(v))
+		}
+
+	case float32:
+		if err = WriteOctet(w, fieldFloat); err == nil {
+			err = WriteLong(w, math.Float32bits(v))
+		}
+
+	case float64:
+		if err = WriteOctet(w, fieldDouble); err == nil {
+			err = WriteLongLong(w, math.Float64bits(v))
+		}
+
+	case string:
+		if err = WriteOctet(w, fieldLongStr); err == nil {
+			err = WriteLongStr(w, v)
+		}
+
+	case []byte:
+		if err = WriteOctet(w, fieldBytes); err == nil {
+			err = WriteLongStr(w, string(v))
+		}
+
+	case time.Time:
+		if err = WriteOctet(w, fieldTimestamp); err == nil {
+			err = WriteLongLong(w, uint64(v.Unix()))
+		}
+
+	case Table:
+		if err = WriteOctet(w, fieldTable); err == nil {
+			err = WriteTable(w, v)
+		}
+
+	case []interface{}:
+		if err = WriteOctet(w, fieldArray); err == nil {
+			err = writeArray(w, v)
+		}
+
+	case nil:
+		err = WriteOctet(w, fieldVoid)
+
+	default:
+		err = fmt.Errorf("unsupported field type %T", v)
+	}
+	return err
+}
+
+func writeArray(w io.Writer, a []interface{}) error {
+	var payload bytes.Buffer
+
+	for _, v := range a {
+		if err := writeField(&payload, v); err != nil {
+			return err
+		}
+	}
+
+	return WriteLongStr(w, payload.String())
+}
+
+// IntValue returns the value of an integer field as an int64.
+// It returns false if the field holds any other type.
+func IntValue(value interface{}) (int64, bool) {
+	switch i := value.(type) {
+	case int8:
+		return int64(i), true
+	case uint8:
+		return int64(i), true
+	case int16:
+		return int64(i), true
+	case uint16:
+		return int64(i), true
+	case int32:
+		return int64(i), true
+	case uint32:
+		return int64(i), true
+	case int64:
+		return i, true
+	case int:
+		return int64(i), true
+	default:
+		return 0, false
+	}
+}
+
+// EqualTables returns true if both tables hold the same fields and values.
+// Tables are compared by their encoding, so nil and empty tables are equal.
+func EqualTables(a, b Table) bool {
+	var encA, encB bytes.Buffer
+	if err := WriteTable(&encA, a); err != nil {
+		return false
+	}
+	if err := WriteTable(&encB, b); err != nil {
+		return false
+	}
+	return bytes.Equal(encA.Bytes(), encB.Bytes())
+}
+
+// ReadTable reads a field table, prefixed with its size
+func ReadTable(r io.Reader) (Table, error) {
+	payload, err := readLongStr(r)
+	if err != nil {
+		return nil, err
+	}
+
+	t := make(Table)
+	buf := bytes.NewReader(payload)
+
+	for buf.Len() > 0 {
+		key, err := ReadShortStr(buf)
+		if err != nil {
+			return nil, errors.New("could not read field name: " + err.Error())
+		}
+		value, err := readField(buf)
+		if err != nil {
+			return nil, fmt.Errorf("could not read field %s: %s", key, err.Error())
+		}
+		t[key] = value
+	}
+	return t, nil
+}
+
+func readField(r io.Reader) (interface{}, error) {
+	fType, err := ReadOctet(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch fType {
+
+	case fieldBool:
+		b, err := ReadOctet(r)
+		if err != nil {
+			return nil, err
+		}
+		return b != 0, nil
+
+	case fieldShortShort:
+		i, err := ReadOctet(r)
+		if err != nil {
+			return nil, err
+		}
+		return int8(i), nil
+
+	case fieldShortShortU:
+		return ReadOctet(r)
+
+	case fieldShortInt:
+		i, err := ReadShort(r)
+		if err != nil {
+			return nil, err
+		}
+		return int16(i), nil
+
+	case fieldShortIntU:
+		return ReadShort(r)
+
+	case fieldLongInt:
+		i, err := ReadLong(r)
+		if err != nil {
+			return nil, err
+		}
+		return int32(i), nil
+
+	case fieldLongIntU:
+		return ReadLong(r)
+
+	case fieldLongLong:
+		i, err := ReadLongLong(r)
+		if err != nil {
+			return nil, err
+		}
+		return int64(i), nil
+
+	case fieldFloat:
+		i, err := ReadLong(r)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(i), nil
+
+	case fieldDouble:
+		i, err := ReadLongLong(r)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(i), nil
+
+	case fieldLongStr:
+		return ReadLongStr(r)
+
+	case fieldBytes:
+		return readLongStr(r)
+
+	case fieldTimestamp:
+		i, err := ReadLongLong(r)
+		if err != nil {
+			return nil, err
+		}
+		return time.Unix(int64(i), 0), nil
+
+	case fieldTable:
+		return ReadTable(r)
+
+	case fieldArray:
+		return readArray(r)
+
+	case fieldVoid:
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported field type %q", fType)
+	}
+}
+
+func readArray(r io.Reader) ([]interface{}, error) {
+	payload, err := readLongStr(r)
+	if err != nil {
+		return nil, err
+	}
+
+	a := make([]interface{}, 0)
+	buf := bytes.NewReader(payload)
+
+	for buf.Len() > 0 {
+		value, err := readField(buf)
+		if err != nil {
+			return nil, errors.New("could not read array value: " + err.Error())
+		}
+		a = append(a, value)
+	}
+	return a, nil
+}
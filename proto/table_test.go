@@ -0,0 +1,264 @@
+package proto
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTrip writes the table and reads it back
+func roundTrip(t *testing.T, table Table) Table {
+	var buf bytes.Buffer
+	if err := WriteTable(&buf, table); err != nil {
+		t.Fatalf("WriteTable: %v", err)
+	}
+	got, err := ReadTable(&buf)
+	if err != nil {
+		t.Fatalf("ReadTable: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("%d bytes left unread", buf.Len())
+	}
+	return got
+}
+
+func TestTableFieldRoundTrip(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{"bool true", true, true},
+		{"bool false", false, false},
+		{"int8", int8(-8), int8(-8)},
+		{"int8 min", int8(math.MinInt8), int8(math.MinInt8)},
+		{"uint8", uint8(200), uint8(200)},
+		{"int16", int16(-1600), int16(-1600)},
+		{"int16 min", int16(math.MinInt16), int16(math.MinInt16)},
+		{"uint16", uint16(60000), uint16(60000)},
+		{"int32", int32(-320000), int32(-320000)},
+		{"int32 min", int32(math.MinInt32), int32(math.MinInt32)},
+		{"uint32", uint32(4000000000), uint32(4000000000)},
+		{"int64", int64(-640000000000), int64(-640000000000)},
+		{"int64 max", int64(math.MaxInt64), int64(math.MaxInt64)},
+		{"int written as int64", int(42), int64(42)},
+		{"float32", float32(0.5), float32(0.5)},
+		{"float32 negative", float32(-1.25), float32(-1.25)},
+		{"float64", 3.141592653589793, 3.141592653589793},
+		{"float64 infinity", math.Inf(1), math.Inf(1)},
+		{"string", "hello", "hello"},
+		{"empty string", "", ""},
+		{"bytes", []byte{0, 1, 0xff}, []byte{0, 1, 0xff}},
+		{"empty bytes", []byte{}, []byte{}},
+		{"timestamp", ts, ts},
+		{"void", nil, nil},
+		{"empty table", Table{}, Table{}},
+		{"empty array", []interface{}{}, []interface{}{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := roundTrip(t, Table{"field": tt.value})
+			value, found := got["field"]
+			if !found {
+				t.Fatal("field missing after round trip")
+			}
+			if !reflect.DeepEqual(value, tt.want) {
+				t.Errorf("got %#v (%T), want %#v (%T)", value, value, tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func TestTableNaNRoundTrip(t *testing.T) {
+	got := roundTrip(t, Table{"nan": math.NaN()})
+	if f, ok := got["nan"].(float64); !ok || !math.IsNaN(f) {
+		t.Errorf("got %#v, want NaN", got["nan"])
+	}
+}
+
+func TestTableNestedRoundTrip(t *testing.T) {
+	ts := time.Unix(1600000000, 0)
+	table := Table{
+		"name": "outer",
+		"inner": Table{
+			"count": int32(3),
+			"deeper": Table{
+				"flag": true,
+				"list": []interface{}{int64(1), "two", nil},
+			},
+		},
+		"array": []interface{}{
+			uint8(1),
+			float32(2.5),
+			[]byte("raw"),
+			ts,
+			Table{"in-array": int16(-2)},
+			[]interface{}{"nested", []interface{}{false}},
+		},
+	}
+
+	got := roundTrip(t, table)
+	if !reflect.DeepEqual(got, table) {
+		t.Errorf("got %#v, want %#v", got, table)
+	}
+}
+
+func TestTableEmptyAndNil(t *testing.T) {
+	for _, table := range []Table{nil, {}} {
+		var buf bytes.Buffer
+		if err := WriteTable(&buf, table); err != nil {
+			t.Fatalf("WriteTable(%#v): %v", table, err)
+		}
+		if !bytes.Equal(buf.Bytes(), []byte{0, 0, 0, 0}) {
+			t.Errorf("WriteTable(%#v) = %v, want an empty long string", table, buf.Bytes())
+		}
+		got, err := ReadTable(&buf)
+		if err != nil {
+			t.Fatalf("ReadTable: %v", err)
+		}
+		if got == nil || len(got) != 0 {
+			t.Errorf("ReadTable = %#v, want an empty table", got)
+		}
+	}
+}
+
+func TestTableKeyOrder(t *testing.T) {
+	table := Table{"c": int8(3), "a": int8(1), "b": int8(2), "aa": int8(4)}
+
+	var first bytes.Buffer
+	if err := WriteTable(&first, table); err != nil {
+		t.Fatalf("WriteTable: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		var again bytes.Buffer
+		if err := WriteTable(&again, table); err != nil {
+			t.Fatalf("WriteTable: %v", err)
+		}
+		if !bytes.Equal(first.Bytes(), again.Bytes()) {
+			t.Fatalf("encodings differ:\n%v\n%v", first.Bytes(), again.Bytes())
+		}
+	}
+
+	// Skip the table size, then read the keys in the order they were written
+	payload := bytes.NewReader(first.Bytes()[4:])
+	keys := make([]string, 0)
+	for payload.Len() > 0 {
+		key, err := ReadShortStr(payload)
+		if err != nil {
+			t.Fatalf("ReadShortStr: %v", err)
+		}
+		keys = append(keys, key)
+		if _, err := readField(payload); err != nil {
+			t.Fatalf("readField: %v", err)
+		}
+	}
+	want := []string{"a", "aa", "b", "c"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys written as %q, want %q", keys, want)
+	}
+}
+
+func TestEqualTables(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Table
+		want bool
+	}{
+		{"nil and empty", nil, Table{}, true},
+		{"same fields", Table{"a": int32(1), "b": "x"}, Table{"b": "x", "a": int32(1)}, true},
+		{"different values", Table{"a": int32(1)}, Table{"a": int32(2)}, false},
+		{"different types", Table{"a": int32(1)}, Table{"a": int64(1)}, false},
+		{"extra field", Table{"a": int32(1)}, Table{"a": int32(1), "b": nil}, false},
+		{"nested", Table{"t": Table{"x": true}}, Table{"t": Table{"x": true}}, true},
+		{"unsupported type", Table{"a": struct{}{}}, Table{"a": struct{}{}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EqualTables(tt.a, tt.b); got != tt.want {
+				t.Errorf("EqualTables(%#v, %#v) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteTableUnsupportedType(t *testing.T) {
+	tests := []struct {
+		name  string
+		table Table
+	}{
+		{"struct", Table{"bad": struct{}{}}},
+		{"uint64", Table{"bad": uint64(1)}},
+		{"map", Table{"bad": map[string]interface{}{}}},
+		{"in nested table", Table{"t": Table{"bad": []string{"x"}}}},
+		{"in array", Table{"a": []interface{}{complex(1, 2)}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := WriteTable(&buf, tt.table)
+			if err == nil {
+				t.Fatal("WriteTable succeeded, want an error")
+			}
+			if !strings.Contains(err.Error(), "unsupported field type") {
+				t.Errorf("error %q does not name the unsupported type", err)
+			}
+		})
+	}
+}
+
+func TestReadTableMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{"missing size", []byte{0, 0}},
+		{"short payload", []byte{0, 0, 0, 10, 1, 'a'}},
+		{"unknown field type", []byte{0, 0, 0, 3, 1, 'a', 'Z'}},
+		{"missing field type", []byte{0, 0, 0, 2, 1, 'a'}},
+		{"truncated value", []byte{0, 0, 0, 4, 1, 'a', 'I', 0}},
+		{"truncated array", []byte{0, 0, 0, 9, 1, 'a', 'A', 0, 0, 0, 2, 'I', 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadTable(bytes.NewReader(tt.input)); err == nil {
+				t.Error("ReadTable succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestIntValue(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  int64
+		ok    bool
+	}{
+		{int8(-1), -1, true},
+		{uint8(255), 255, true},
+		{int16(-300), -300, true},
+		{uint16(65535), 65535, true},
+		{int32(-70000), -70000, true},
+		{uint32(4294967295), 4294967295, true},
+		{int64(1 << 40), 1 << 40, true},
+		{int(7), 7, true},
+		{float64(1), 0, false},
+		{"1", 0, false},
+		{nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := IntValue(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("IntValue(%#v) = %d, %v, want %d, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/sauravgsh16/message-server/proto"
 )
@@ -16,30 +18,22 @@ const (
 	chClosed
 )
 
-// TODO: MOVE TO RELEVANT PLACE
-
-// Return struct
-type Return struct{}
-
-// Confirmation struct
-type Confirmation struct {
-	DeliveryTag uint64
-	State       bool
-}
-
-type confirms struct{}
-
-func (c *confirms) AddListener(ch chan Confirmation) {}
-
-// TODO: to move code ends here
-
 // MetaData struct used when publishing message. Describe the metadata of the message
 type MetaDataWithBody struct {
-	ContentType   string
-	MessageID     string
-	UserID        string
-	ApplicationID string
-	Body          []byte
+	ContentType     string
+	ContentEncoding string
+	MessageID       string
+	CorrelationID   string
+	ReplyTo         string
+	UserID          string
+	ApplicationID   string
+	Type            string
+	Headers         proto.Table
+	DeliveryMode    uint8
+	Expiration      string
+	Priority        uint8
+	Timestamp       time.Time
+	Body            []byte
 }
 
 // Channel struct
@@ -48,15 +42,16 @@ type Channel struct {
 	destructor      sync.Once
 	incoming        chan proto.Frame
 	outgoing        chan proto.Frame
-	outgoingContent chan proto.Frame
+	outgoingContent chan []proto.Frame
 	rpc             chan proto.MessageFrame
 	conn            *Connection
 	consumers       *Consumers
 	sendMux         sync.Mutex
 	notifyMux       sync.Mutex
-	state           uint8
+	state           uint32
 	errors          chan *proto.Error
 	confirms        *confirms
+	confirming      bool
 	flows           []chan bool
 	cancels         []chan string
 	closes          []chan *proto.Error
@@ -77,6 +72,7 @@ func newChannel(c *Connection, id uint16, wg *sync.WaitGroup) *Channel {
 		outgoingContent: c.outgoingContent,
 		rpc:             make(chan proto.MessageFrame),
 		consumers:       CreateNewConsumers(),
+		confirms:        newConfirms(),
 		done:            make(chan interface{}),
 		errors:          make(chan *proto.Error),
 		contentWg:       wg,
@@ -114,11 +110,21 @@ func (ch *Channel) call(req proto.MessageFrame, resp ...proto.MessageFrame) erro
 	return nil
 }
 
+// getState returns the state of the channel. The state is changed by the
+// channel, and by the connection when it shuts the channel down.
+func (ch *Channel) getState() uint32 {
+	return atomic.LoadUint32(&ch.state)
+}
+
+func (ch *Channel) setState(state uint32) {
+	atomic.StoreUint32(&ch.state, state)
+}
+
 func (ch *Channel) send(msgf proto.MessageFrame) error {
 
 	fmt.Printf("Sending: %s\n", msgf.MethodName())
 
-	if ch.state == chClosed {
+	if ch.getState() == chClosed {
 		return ch.sendClosed(msgf)
 	}
 
@@ -127,9 +133,16 @@ func (ch *Channel) send(msgf proto.MessageFrame) error {
 
 func (ch *Channel) sendOpen(msgf proto.MessageFrame) error {
 
+	// The send lock is held till all frames of a message are written,
+	// so no other method of the channel is sent in between them
 	ch.sendMux.Lock()
 	defer ch.sendMux.Unlock()
 
+	// Publishes are numbered in the order they are sent
+	if _, ok := msgf.(*proto.BasicPublish); ok && ch.confirming {
+		ch.confirms.Publish()
+	}
+
 	if mcf, ok := msgf.(proto.MessageContentFrame); ok {
 
 		prop, body := mcf.GetContent()
@@ -138,25 +151,26 @@ func (ch *Channel) sendOpen(msgf proto.MessageFrame) error {
 
 		ch.contentWg.Add(1)
 
-		// Send Method
-		ch.outgoingContent <- &proto.MethodFrame{
-			ChannelID: ch.id,
-			Method:    mcf,
-		}
-
-		// Send Header
-		ch.outgoingContent <- &proto.HeaderFrame{
-			Class:      clsID,
-			ChannelID:  ch.id,
-			BodySize:   size,
-			Properties: prop,
+		frames := []proto.Frame{
+			// Method
+			&proto.MethodFrame{
+				ChannelID: ch.id,
+				Method:    mcf,
+			},
+			// Header
+			&proto.HeaderFrame{
+				Class:      clsID,
+				ChannelID:  ch.id,
+				BodySize:   size,
+				Properties: prop,
+			},
 		}
 
-		// Send Body
-		ch.outgoingContent <- &proto.BodyFrame{
-			ChannelID: ch.id,
-			Body:      body,
+		// Body, split to fit the frame max
+		for _, bf := range proto.BodyFrames(ch.id, body, ch.conn.maxFrameSize()) {
+			frames = append(frames, bf)
 		}
+		ch.outgoingContent <- frames
 
 		ch.contentWg.Wait()
 
@@ -211,11 +225,15 @@ func (ch *Channel) shutdown(err *proto.Error) {
 			}
 		}
 
-		ch.state = chClosed
+		ch.setState(chClosed)
 
-		// Notify select loop for ch.rpc
+		// Notify select loop for ch.rpc, if a call is waiting.
+		// Otherwise closing ch.errors below is enough.
 		if err != nil {
-			ch.errors <- err
+			select {
+			case ch.errors <- err:
+			default:
+			}
 		}
 
 		ch.consumers.close()
@@ -236,6 +254,8 @@ func (ch *Channel) shutdown(err *proto.Error) {
 			close(ca)
 		}
 
+		ch.confirms.Close()
+
 		ch.closes = nil
 		ch.flows = nil
 		ch.returns = nil
@@ -246,12 +266,12 @@ func (ch *Channel) shutdown(err *proto.Error) {
 }
 
 func (ch *Channel) startReceiver() {
-	if ch.state == 0 {
-		ch.state = chOpen
+	if ch.getState() == chInit {
+		ch.setState(chOpen)
 	}
 	go func() {
 		for {
-			if ch.state == chClosed {
+			if ch.getState() == chClosed {
 				break
 			}
 			var err *proto.Error
@@ -268,12 +288,12 @@ func (ch *Channel) startReceiver() {
 					err = ch.handleMethod(m)
 
 				case *proto.HeaderFrame:
-					if ch.state != chClosing {
+					if ch.getState() != chClosing {
 						err = ch.handleHeader(m)
 					}
 
 				case *proto.BodyFrame:
-					if ch.state != chClosing {
+					if ch.getState() != chClosing {
 						err = ch.handleBody(m)
 					}
 
@@ -293,9 +313,7 @@ func (ch *Channel) dispatchRPC(msgf proto.MessageFrame) *proto.Error {
 	switch m := msgf.(type) {
 
 	case *proto.ChannelClose:
-		ch.sendMux.Lock()
 		ch.send(&proto.ChannelCloseOk{})
-		ch.sendMux.Unlock()
 		ch.conn.closeChannel(ch, proto.NewSoftError(m.ReplyCode, m.ReplyText, m.ClassId, m.MethodId))
 
 	case *proto.ChannelFlow:
@@ -315,14 +333,25 @@ func (ch *Channel) dispatchRPC(msgf proto.MessageFrame) *proto.Error {
 		ch.consumers.cancel(m.ConsumerTag)
 
 	case *proto.BasicReturn:
-		p := fmt.Sprintf("Not implemented %#v\n", m)
-		panic(p)
+		ch.notifyMux.Lock()
+		for _, c := range ch.returns {
+			c <- newReturn(m)
+		}
+		ch.notifyMux.Unlock()
 
 	case *proto.BasicAck:
-		panic("Not implemented")
+		if m.Multiple {
+			ch.confirms.Multiple(Confirmation{DeliveryTag: m.DeliveryTag, State: true})
+		} else {
+			ch.confirms.One(Confirmation{DeliveryTag: m.DeliveryTag, State: true})
+		}
 
 	case *proto.BasicNack:
-		panic("Not implemented")
+		if m.Multiple {
+			ch.confirms.Multiple(Confirmation{DeliveryTag: m.DeliveryTag, State: false})
+		} else {
+			ch.confirms.One(Confirmation{DeliveryTag: m.DeliveryTag, State: false})
+		}
 
 	case *proto.BasicDeliver:
 		ch.consumers.send(m.ConsumerTag, newDelivery(ch, m))
@@ -375,6 +404,10 @@ func (ch *Channel) handleBody(bf *proto.BodyFrame) *proto.Error {
 	if size < ch.currentMsg.Header.BodySize {
 		return nil
 	}
+	if size > ch.currentMsg.Header.BodySize {
+		ch.resetCurMsg()
+		return proto.NewHardError(proto.FrameErr, "Body exceeds the size in the content header", 0, 0)
+	}
 
 	// Set MessageFrame's body with all content recieved
 	ch.bodyMf.SetContent(ch.currentMsg.Header.Properties, ch.currentMsg.Payload)
@@ -499,38 +532,58 @@ func (ch *Channel) NotifyPublish(c chan Confirmation) chan Confirmation {
 }
 
 // ExchangeDeclare declares an exchange
-func (ch *Channel) ExchangeDeclare(name, etype string, noWait bool) error {
+func (ch *Channel) ExchangeDeclare(name, etype string, durable, noWait bool, args proto.Table) error {
 	return ch.call(
 		&proto.ExchangeDeclare{
-			Exchange: name,
-			Type:     etype,
-			NoWait:   noWait,
+			Exchange:  name,
+			Type:      etype,
+			Durable:   durable,
+			NoWait:    noWait,
+			Arguments: args,
 		},
 		&proto.ExchangeDeclareOk{},
 	)
 }
 
-// ExchangeBind binds an exchange to a routing key
-func (ch *Channel) ExchangeBind(dest, src, routingKey string, noWait bool) error {
+// ExchangeInspect passively declares the exchange. It returns the counts
+// of its bindings and scheduled messages, or a 404 error if it does not exist.
+func (ch *Channel) ExchangeInspect(name string) (*proto.ExchangeDeclareOk, error) {
+	req := &proto.ExchangeDeclare{
+		Exchange: name,
+		Passive:  true,
+	}
+	resp := &proto.ExchangeDeclareOk{}
+
+	if err := ch.call(req, resp); err != nil {
+		return &proto.ExchangeDeclareOk{}, err
+	}
+	return resp, nil
+}
+
+// ExchangeBind binds the destination exchange to the source exchange.
+// Messages routed by src with the routing key are routed further by dest
+func (ch *Channel) ExchangeBind(dest, src, routingKey string, noWait bool, args proto.Table) error {
 	return ch.call(
 		&proto.ExchangeBind{
 			Destination: dest,
 			Source:      src,
 			RoutingKey:  routingKey,
 			NoWait:      noWait,
+			Arguments:   args,
 		},
 		&proto.ExchangeBindOk{},
 	)
 }
 
 // ExchangeUnbind unbinds an exchange
-func (ch *Channel) ExchangeUnbind(dest, src, routingKey string, noWait bool) error {
+func (ch *Channel) ExchangeUnbind(dest, src, routingKey string, noWait bool, args proto.Table) error {
 	return ch.call(
 		&proto.ExchangeUnbind{
 			Destination: dest,
 			Source:      src,
 			RoutingKey:  routingKey,
 			NoWait:      noWait,
+			Arguments:   args,
 		},
 		&proto.ExchangeUnbindOk{},
 	)
@@ -548,11 +601,16 @@ func (ch *Channel) ExchangeDelete(name string, ifunused, noWait bool) error {
 	)
 }
 
-// QueueDeclare declares a queue
-func (ch *Channel) QueueDeclare(name string, noWait bool) (*proto.QueueDeclareOk, error) {
+// QueueDeclare declares a queue. If the name is empty, the server
+// names the queue and returns the name in QueueDeclareOk
+func (ch *Channel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args proto.Table) (*proto.QueueDeclareOk, error) {
 	req := &proto.QueueDeclare{
-		Queue:  name,
-		NoWait: noWait,
+		Queue:      name,
+		Durable:    durable,
+		Exclusive:  exclusive,
+		AutoDelete: autoDelete,
+		NoWait:     noWait,
+		Arguments:  args,
 	}
 	resp := &proto.QueueDeclareOk{}
 
@@ -565,26 +623,45 @@ func (ch *Channel) QueueDeclare(name string, noWait bool) (*proto.QueueDeclareOk
 	return &proto.QueueDeclareOk{Queue: name}, nil
 }
 
-// QueueBind binds a queue
-func (ch *Channel) QueueBind(name, exchange, key string, noWait bool) error {
+// QueueInspect passively declares the queue. It returns the counts of its
+// messages and consumers, or a 404 error if it does not exist. Unlike
+// QueueDeclare, it never creates the queue.
+func (ch *Channel) QueueInspect(name string) (*proto.QueueDeclareOk, error) {
+	req := &proto.QueueDeclare{
+		Queue:   name,
+		Passive: true,
+	}
+	resp := &proto.QueueDeclareOk{}
+
+	if err := ch.call(req, resp); err != nil {
+		return &proto.QueueDeclareOk{}, err
+	}
+	return resp, nil
+}
+
+// QueueBind binds a queue. Arguments are matched against
+// message headers when binding to a headers exchange
+func (ch *Channel) QueueBind(name, exchange, key string, noWait bool, args proto.Table) error {
 	return ch.call(
 		&proto.QueueBind{
 			Queue:      name,
 			Exchange:   exchange,
 			RoutingKey: key,
 			NoWait:     noWait,
+			Arguments:  args,
 		},
 		&proto.QueueBindOk{},
 	)
 }
 
 // QueueUnbind unbinds queue
-func (ch *Channel) QueueUnbind(name, exchange, key string) error {
+func (ch *Channel) QueueUnbind(name, exchange, key string, args proto.Table) error {
 	return ch.call(
 		&proto.QueueUnbind{
 			Queue:      name,
 			Exchange:   exchange,
 			RoutingKey: key,
+			Arguments:  args,
 		},
 		&proto.QueueUnbindOk{},
 	)
@@ -602,26 +679,46 @@ func (ch *Channel) QueueDelete(name string, ifunused, ifempty, noWait bool) (int
 	return int(resp.MessageCnt), ch.call(req, resp)
 }
 
-// Publish a message
-func (ch *Channel) Publish(exchange, key string, immediate bool, meta MetaDataWithBody) error {
+// QueuePurge removes all the messages waiting in the queue, keeping its
+// bindings and consumers. It returns the count of messages purged.
+func (ch *Channel) QueuePurge(name string, noWait bool) (int, error) {
+	req := &proto.QueuePurge{
+		Queue:  name,
+		NoWait: noWait,
+	}
+	resp := &proto.QueuePurgeOk{}
+	if err := ch.call(req, resp); err != nil {
+		return 0, err
+	}
+	return int(resp.MessageCnt), nil
+}
+
+// Publish a message. Mandatory messages which cannot be routed to
+// any queue are returned, and sent to the NotifyReturn listeners.
+func (ch *Channel) Publish(exchange, key string, mandatory, immediate bool, meta MetaDataWithBody) error {
 	bp := &proto.BasicPublish{
 		Exchange:   exchange,
 		RoutingKey: key,
+		Mandatory:  mandatory,
 		Immediate:  immediate,
 		Body:       meta.Body,
 		Properties: proto.Properties{
-			ContentType:   meta.ContentType,
-			MessageID:     meta.MessageID,
-			UserID:        meta.UserID,
-			ApplicationID: meta.ApplicationID,
+			ContentType:     meta.ContentType,
+			ContentEncoding: meta.ContentEncoding,
+			MessageID:       meta.MessageID,
+			CorrelationID:   meta.CorrelationID,
+			ReplyTo:         meta.ReplyTo,
+			UserID:          meta.UserID,
+			ApplicationID:   meta.ApplicationID,
+			Type:            meta.Type,
+			Headers:         meta.Headers,
+			DeliveryMode:    meta.DeliveryMode,
+			Expiration:      meta.Expiration,
+			Priority:        meta.Priority,
+			Timestamp:       meta.Timestamp,
 		},
 	}
-	ch.currentMsg = proto.NewMessage(bp)
-	if err := ch.send(bp); err != nil {
-		return err
-	}
-	ch.currentMsg = nil
-	return nil
+	return ch.send(bp)
 }
 
 // Cancel a consumer
@@ -640,12 +737,13 @@ func (ch *Channel) Cancel(tag string, noWait bool) error {
 }
 
 // Consume messages
-func (ch *Channel) Consume(queue, consumer string, noAck, noWait bool) (<-chan Delivery, error) {
+func (ch *Channel) Consume(queue, consumer string, noAck, noWait bool, args proto.Table) (<-chan Delivery, error) {
 	req := &proto.BasicConsume{
 		Queue:       queue,
 		ConsumerTag: consumer,
 		NoAck:       noAck,
 		NoWait:      noWait,
+		Arguments:   args,
 	}
 	resp := &proto.BasicConsumeOk{}
 
@@ -660,22 +758,52 @@ func (ch *Channel) Consume(queue, consumer string, noAck, noWait bool) (<-chan D
 	return dChan, nil
 }
 
-// Ack message
-func (ch *Channel) Ack(tag uint64, multiple bool) error {
-	ch.sendMux.Lock()
-	defer ch.sendMux.Unlock()
+// Qos sets the number of messages or bytes the server delivers before
+// waiting for acknowledgements. Zero means no limit. If global is set, the
+// limits are shared by all consumers on the channel, otherwise they apply to
+// each consumer started on the channel afterwards.
+func (ch *Channel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	return ch.call(
+		&proto.BasicQos{
+			PrefetchCount: uint16(prefetchCount),
+			PrefetchSize:  uint32(prefetchSize),
+			Global:        global,
+		},
+		&proto.BasicQosOk{},
+	)
+}
+
+// Get fetches a single message from the queue. ok is false if the queue is empty.
+// Unless noAck is set, the message needs to be acknowledged with Ack or Nack.
+func (ch *Channel) Get(queue string, noAck bool) (Delivery, bool, error) {
+	req := &proto.BasicGet{
+		Queue: queue,
+		NoAck: noAck,
+	}
+	getOk := &proto.BasicGetOk{}
+	getEmpty := &proto.BasicGetEmpty{}
+
+	if err := ch.call(req, getOk, getEmpty); err != nil {
+		return Delivery{}, false, err
+	}
 
+	if getOk.DeliveryTag > 0 {
+		return *newDelivery(ch, getOk), true, nil
+	}
+	return Delivery{}, false, nil
+}
+
+// Ack message. Acks are sent under the send lock, and so are never
+// written between the frames of a message being published on the channel.
+func (ch *Channel) Ack(tag uint64, multiple bool) error {
 	return ch.send(&proto.BasicAck{
 		DeliveryTag: tag,
 		Multiple:    multiple,
 	})
 }
 
-// Nack not ack
+// Nack not ack. Like Ack, it is sent under the send lock.
 func (ch *Channel) Nack(tag uint64, multiple bool, requeue bool) error {
-	ch.sendMux.Lock()
-	defer ch.sendMux.Unlock()
-
 	return ch.send(&proto.BasicNack{
 		DeliveryTag: tag,
 		Multiple:    multiple,
@@ -683,6 +811,23 @@ func (ch *Channel) Nack(tag uint64, multiple bool, requeue bool) error {
 	})
 }
 
+// Confirm puts the channel in confirm mode. The server acknowledges
+// every publish once the message has been persisted, which is notified
+// to listeners registered with NotifyPublish or NotifyConfirm
+func (ch *Channel) Confirm(noWait bool) error {
+	if err := ch.call(
+		&proto.ConfirmSelect{NoWait: noWait},
+		&proto.ConfirmSelectOk{},
+	); err != nil {
+		return err
+	}
+
+	ch.sendMux.Lock()
+	ch.confirming = true
+	ch.sendMux.Unlock()
+	return nil
+}
+
 // TxSelect transaction select
 func (ch *Channel) TxSelect() error {
 	return ch.call(
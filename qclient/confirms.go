@@ -0,0 +1,107 @@
+package qclient
+
+import (
+	"sync"
+)
+
+// Confirmation struct
+type Confirmation struct {
+	DeliveryTag uint64
+	State       bool
+}
+
+// confirms struct keeps track of published messages and
+// notifies listeners of their confirmation in publish order
+type confirms struct {
+	mux       sync.Mutex
+	listeners []chan Confirmation
+	sequencer map[uint64]Confirmation
+	published uint64
+	expecting uint64
+}
+
+func newConfirms() *confirms {
+	return &confirms{
+		sequencer: make(map[uint64]Confirmation),
+		published: 0,
+		expecting: 1,
+	}
+}
+
+// AddListener adds a channel to be notified of confirmations
+func (c *confirms) AddListener(ch chan Confirmation) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.listeners = append(c.listeners, ch)
+}
+
+// Publish increments and returns the publish sequence number
+func (c *confirms) Publish() uint64 {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.published++
+	return c.published
+}
+
+func (c *confirms) confirm(conf Confirmation) {
+	c.expecting++
+
+	for _, l := range c.listeners {
+		l <- conf
+	}
+}
+
+// resequence notifies the confirmations which were waiting on earlier ones
+func (c *confirms) resequence() {
+	for c.expecting <= c.published {
+		conf, found := c.sequencer[c.expecting]
+		if !found {
+			return
+		}
+		delete(c.sequencer, c.expecting)
+		c.confirm(conf)
+	}
+}
+
+// One confirms a single delivery tag
+func (c *confirms) One(conf Confirmation) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	switch {
+	case conf.DeliveryTag < c.expecting:
+		// Duplicate or stale, the tag has already been confirmed
+		return
+	case conf.DeliveryTag == c.expecting:
+		c.confirm(conf)
+	default:
+		c.sequencer[conf.DeliveryTag] = conf
+	}
+	c.resequence()
+}
+
+// Multiple confirms all delivery tags upto and including the given one
+func (c *confirms) Multiple(conf Confirmation) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for c.expecting <= conf.DeliveryTag {
+		// Tags confirmed earlier out of order are covered by this confirmation
+		delete(c.sequencer, c.expecting)
+		c.confirm(Confirmation{DeliveryTag: c.expecting, State: conf.State})
+	}
+	c.resequence()
+}
+
+// Close closes all listeners
+func (c *confirms) Close() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for _, l := range c.listeners {
+		close(l)
+	}
+	c.listeners = nil
+}
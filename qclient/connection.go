@@ -9,6 +9,7 @@ import (
 	"os"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sauravgsh16/message-server/allocate"
@@ -17,7 +18,12 @@ import (
 
 const (
 	defaultConnTimeout = 30 * time.Second
-	contentFrames      = 3
+	defaultHeartbeat   = 10 * time.Second
+	defaultFrameMax    = 128 * 1024
+	defaultChannelMax  = 2047
+	// heartbeatMisses is the number of heartbeat intervals without any
+	// frame from the server, after which the server is taken as dead
+	heartbeatMisses = 2
 )
 
 var (
@@ -25,6 +31,8 @@ var (
 	ErrInvalidCommand = errors.New("Invalid command received")
 	ErrGetHostName    = errors.New("Unable to retrieve Host Name")
 	ErrHost           = errors.New("Corrupt HostName")
+	ErrHeartbeatValue = errors.New("Heartbeat must be zero, or at least one second")
+	ErrFrameMaxValue  = fmt.Errorf("Frame max must be zero, or at least %d", proto.FrameMinSize)
 )
 
 // ConnectionStatus represents connection status
@@ -46,7 +54,7 @@ type Connection struct {
 	conn            io.ReadWriteCloser
 	channels        map[uint16]*Channel
 	outgoing        chan proto.Frame
-	outgoingContent chan proto.Frame
+	outgoingContent chan []proto.Frame
 	incoming        chan proto.MessageFrame
 	status          ConnectionStatus
 	statusMux       sync.RWMutex
@@ -54,14 +62,63 @@ type Connection struct {
 	allocator       *allocate.Allocator
 	writer          *proto.Writer
 	contentWg       sync.WaitGroup
+	frameMax        uint32
+	channelMax      uint32
+	config          Config
+	lastSent        int64
+	lastRecv        int64
+}
+
+// Config holds the limits the client asks for when the connection is tuned.
+// The server's limits apply where they are lower. Zero FrameMax and ChannelMax
+// mean no limit, and any other FrameMax must be at least proto.FrameMinSize.
+// Heartbeat is sent in whole seconds, rounded down, so it must be at least
+// one second. Zero turns heartbeats off.
+type Config struct {
+	Heartbeat  time.Duration
+	FrameMax   uint32
+	ChannelMax uint16
+}
+
+// validate checks the config holds values the connection can be tuned with
+func (config Config) validate() error {
+	if config.Heartbeat < 0 || (config.Heartbeat > 0 && config.Heartbeat < time.Second) {
+		return ErrHeartbeatValue
+	}
+	if !validFrameMax(config.FrameMax) {
+		return ErrFrameMaxValue
+	}
+	return nil
+}
+
+// validFrameMax returns true for no limit, or a limit which fits
+// the smallest frames of the protocol
+func validFrameMax(frameMax uint32) bool {
+	return frameMax == 0 || frameMax >= proto.FrameMinSize
+}
+
+func defaultConfig() Config {
+	return Config{
+		Heartbeat:  defaultHeartbeat,
+		FrameMax:   defaultFrameMax,
+		ChannelMax: defaultChannelMax,
+	}
 }
 
 // Dial to connect to a listener
 func Dial(url string) (*Connection, error) {
-	return dial(url)
+	return dial(url, defaultConfig())
+}
+
+// DialConfig connects to a listener, and tunes the connection with the config
+func DialConfig(url string, config Config) (*Connection, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return dial(url, config)
 }
 
-func dial(url string) (*Connection, error) {
+func dial(url string, config Config) (*Connection, error) {
 	uri, err := parseURL(url)
 	if err != nil {
 		return nil, err
@@ -71,7 +128,7 @@ func dial(url string) (*Connection, error) {
 	if err != nil {
 		return nil, err
 	}
-	return Open(conn)
+	return OpenConfig(conn, config)
 }
 
 func dialer(netType, addr string, timeout time.Duration) (net.Conn, error) {
@@ -84,15 +141,25 @@ func dialer(netType, addr string, timeout time.Duration) (net.Conn, error) {
 
 // Open a connection
 func Open(conn io.ReadWriteCloser) (*Connection, error) {
+	return OpenConfig(conn, defaultConfig())
+}
+
+// OpenConfig opens a connection, and tunes it with the config
+func OpenConfig(conn io.ReadWriteCloser, config Config) (*Connection, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
 	c := &Connection{
 		conn:            conn,
 		channels:        make(map[uint16]*Channel),
 		outgoing:        make(chan proto.Frame),
-		outgoingContent: make(chan proto.Frame),
+		outgoingContent: make(chan []proto.Frame),
 		incoming:        make(chan proto.MessageFrame),
 		errors:          make(chan *proto.Error, 1),
 		status:          ConnectionStatus{},
 		writer:          &proto.Writer{W: bufio.NewWriter(conn)},
+		frameMax:        proto.FrameMinSize,
+		config:          config,
 	}
 	go c.handleOutgoing()
 	go c.handleOutgoingContent()
@@ -125,16 +192,28 @@ func (c *Connection) Close() error {
 }
 
 func (c *Connection) send(f proto.Frame) error {
-	if c.status.closed {
+	return c.sendFrames([]proto.Frame{f})
+}
+
+// sendFrames writes the frames together. The send lock is held till all
+// of them are written, so no other frame is written in between them.
+func (c *Connection) sendFrames(frames []proto.Frame) error {
+	if c.IsClosed() {
 		return proto.NewHardError(500, "Sending on closed channel/Connection", 0, 0)
 	}
-	c.mux.Lock()
-	err := c.writer.WriteFrame(f)
-	c.mux.Unlock()
+	var err error
+	c.sendMux.Lock()
+	for _, f := range frames {
+		if err = c.writer.WriteFrame(f); err != nil {
+			break
+		}
+	}
+	c.sendMux.Unlock()
 	if err != nil {
 		pErr := proto.NewHardError(500, err.Error(), 0, 0)
 		go c.hardClose(pErr)
 	}
+	atomic.StoreInt64(&c.lastSent, time.Now().UnixNano())
 	return err
 }
 
@@ -195,9 +274,89 @@ func (c *Connection) openStart() error {
 	if err := c.send(&proto.MethodFrame{ChannelID: uint16(0), Method: startOk}); err != nil {
 		return err
 	}
+	return c.openTune()
+}
+
+func (c *Connection) openTune() error {
+	tune := &proto.ConnectionTune{}
+
+	if err := c.call(nil, tune); err != nil {
+		return err
+	}
+
+	tuneOk := &proto.ConnectionTuneOk{
+		ChannelMax: uint16(negotiate(uint32(c.config.ChannelMax), uint32(tune.ChannelMax))),
+		FrameMax:   negotiate(c.config.FrameMax, tune.FrameMax),
+	}
+	// The server closes the connection on a frame max it cannot use,
+	// so one offered below the minimum is reported before TuneOk
+	if !validFrameMax(tuneOk.FrameMax) {
+		return ErrFrameMaxValue
+	}
+	if heartbeat := uint32(c.config.Heartbeat / time.Second); heartbeat > 0 {
+		tuneOk.Heartbeat = uint16(negotiate(heartbeat, uint32(tune.Heartbeat)))
+	}
+	if err := c.send(&proto.MethodFrame{ChannelID: uint16(0), Method: tuneOk}); err != nil {
+		return err
+	}
+
+	atomic.StoreUint32(&c.frameMax, tuneOk.FrameMax)
+	atomic.StoreUint32(&c.channelMax, uint32(tuneOk.ChannelMax))
+
+	if tuneOk.Heartbeat > 0 {
+		go c.heartbeat(time.Duration(tuneOk.Heartbeat) * time.Second)
+	}
 	return c.openHost()
 }
 
+// heartbeat sends heartbeats while the connection is idle, and closes
+// the connection once nothing is heard from the server for heartbeatMisses intervals
+func (c *Connection) heartbeat(interval time.Duration) {
+	now := time.Now().UnixNano()
+	atomic.StoreInt64(&c.lastSent, now)
+	atomic.StoreInt64(&c.lastRecv, now)
+
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if c.IsClosed() {
+			return
+		}
+
+		if time.Since(time.Unix(0, atomic.LoadInt64(&c.lastRecv))) >= heartbeatMisses*interval {
+			c.hardClose(ErrHeartbeat)
+			return
+		}
+
+		if time.Since(time.Unix(0, atomic.LoadInt64(&c.lastSent))) >= interval {
+			if err := c.send(&proto.HeartbeatFrame{}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// negotiate returns the lower of the client and server limits,
+// where zero means no limit
+func negotiate(client, server uint32) uint32 {
+	if client == 0 || (server != 0 && server < client) {
+		return server
+	}
+	return client
+}
+
+// maxFrameSize returns the largest frame sent or received on the connection
+func (c *Connection) maxFrameSize() uint32 {
+	return atomic.LoadUint32(&c.frameMax)
+}
+
+// maxChannels returns the highest channel id on the connection,
+// where zero means no limit
+func (c *Connection) maxChannels() uint32 {
+	return atomic.LoadUint32(&c.channelMax)
+}
+
 func (c *Connection) openHost() error {
 	host, err := os.Hostname()
 	if err != nil {
@@ -209,14 +368,20 @@ func (c *Connection) openHost() error {
 	if err := c.call(req, res); err != nil {
 		return ErrHost
 	}
-	c.allocator = allocate.NewAllocator()
+	c.allocator = allocate.NewAllocator(int(c.maxChannels()))
 	return nil
 }
 
 func (c *Connection) hardClose(err *proto.Error) {
+	c.statusMux.Lock()
 	c.status.closing = true
+	c.statusMux.Unlock()
 
 	c.destructor.Do(func() {
+		c.statusMux.Lock()
+		c.status.closed = true
+		c.statusMux.Unlock()
+
 		c.mux.Lock()
 		defer c.mux.Unlock()
 
@@ -232,7 +397,7 @@ func (c *Connection) hardClose(err *proto.Error) {
 		c.conn.Close()
 
 		c.channels = map[uint16]*Channel{}
-		c.allocator = allocate.NewAllocator()
+		c.allocator = allocate.NewAllocator(int(c.maxChannels()))
 	})
 }
 
@@ -255,15 +420,17 @@ func (c *Connection) handleIncoming(r io.Reader) {
 	frames := &proto.Reader{R: buf}
 
 	for {
-		if c.status.closed {
+		if c.IsClosed() {
 			break
 		}
+		frames.FrameMax = c.maxFrameSize()
 		frame, err := frames.ReadFrame()
 		if err != nil {
 			pErr := proto.NewHardError(500, err.Error(), 0, 0)
 			c.hardClose(pErr)
 			break
 		}
+		atomic.StoreInt64(&c.lastRecv, time.Now().UnixNano())
 		if frame != nil {
 			c.handleFrame(frame)
 		}
@@ -272,7 +439,7 @@ func (c *Connection) handleIncoming(r io.Reader) {
 
 func (c *Connection) handleOutgoing() {
 	for {
-		if c.status.closed {
+		if c.IsClosed() {
 			break
 		}
 		frame := <-c.outgoing
@@ -280,19 +447,14 @@ func (c *Connection) handleOutgoing() {
 	}
 }
 
+// handleOutgoingContent writes the method, header and body frames
+// of a message together
 func (c *Connection) handleOutgoingContent() {
-	buf := make([]proto.Frame, 0, 3)
 	for {
 		select {
-		case frame := <-c.outgoingContent:
-			buf = append(buf, frame)
-			if len(buf) == contentFrames {
-				for _, f := range buf {
-					c.send(f)
-				}
-				buf = nil
-				c.contentWg.Done()
-			}
+		case frames := <-c.outgoingContent:
+			c.sendFrames(frames)
+			c.contentWg.Done()
 		}
 	}
 }
@@ -311,6 +473,9 @@ func (c *Connection) dispatch0(f proto.Frame) {
 	case *proto.MethodFrame:
 		c.routeMethod(mf)
 
+	case *proto.HeartbeatFrame:
+		// Heartbeats only tell that the server is alive
+
 	default:
 		c.closeWithErr(ErrUnexpectedFrame)
 	}
@@ -389,6 +554,7 @@ func (c *Connection) releaseChannel(id uint16) {
 	defer c.mux.Unlock()
 
 	delete(c.channels, id)
+	c.allocator.Release(int(id))
 }
 
 func (c *Connection) openChannel() (*Channel, error) {
@@ -0,0 +1,135 @@
+package qclient
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sauravgsh16/message-server/proto"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr error
+	}{
+		{"default", defaultConfig(), nil},
+		{"heartbeat off", Config{}, nil},
+		{"heartbeat one second", Config{Heartbeat: time.Second}, nil},
+		{"heartbeat not whole seconds", Config{Heartbeat: 1500 * time.Millisecond}, nil},
+		{"heartbeat under a second", Config{Heartbeat: 500 * time.Millisecond}, ErrHeartbeatValue},
+		{"heartbeat one nanosecond", Config{Heartbeat: 1}, ErrHeartbeatValue},
+		{"heartbeat negative", Config{Heartbeat: -time.Second}, ErrHeartbeatValue},
+		{"frame max no limit", Config{FrameMax: 0}, nil},
+		{"frame max minimum", Config{FrameMax: proto.FrameMinSize}, nil},
+		{"frame max below minimum", Config{FrameMax: proto.FrameMinSize - 1}, ErrFrameMaxValue},
+		{"frame max one", Config{FrameMax: 1}, ErrFrameMaxValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); err != tt.wantErr {
+				t.Errorf("validate() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDialConfigRejectsInvalidConfig(t *testing.T) {
+	// The config is checked before anything is dialed
+	_, err := DialConfig("tcp://localhost:9000", Config{Heartbeat: time.Millisecond})
+	if err != ErrHeartbeatValue {
+		t.Errorf("DialConfig() = %v, want %v", err, ErrHeartbeatValue)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		client, server, want uint32
+	}{
+		{0, 0, 0},
+		{0, 2047, 2047},
+		{100, 0, 100},
+		{100, 2047, 100},
+		{4096, 2047, 2047},
+		{2047, 2047, 2047},
+	}
+
+	for _, tt := range tests {
+		if got := negotiate(tt.client, tt.server); got != tt.want {
+			t.Errorf("negotiate(%d, %d) = %d, want %d", tt.client, tt.server, got, tt.want)
+		}
+	}
+}
+
+// tuneWith opens a client connection against a server which offers the tune,
+// and returns the frame sent after the tune along with the error from opening
+func tuneWith(t *testing.T, config Config, tune *proto.ConnectionTune) (proto.Frame, error) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	sent := make(chan proto.Frame, 1)
+	go func() {
+		defer server.Close()
+		defer close(sent)
+
+		if _, err := io.ReadFull(server, make([]byte, 5)); err != nil {
+			return
+		}
+		w := proto.Writer{W: server}
+		r := proto.Reader{R: server}
+		w.WriteFrame(&proto.MethodFrame{Method: &proto.ConnectionStart{Mechanisms: "PLAIN"}})
+		if _, err := r.ReadFrame(); err != nil {
+			return
+		}
+		w.WriteFrame(&proto.MethodFrame{Method: tune})
+		if f, err := r.ReadFrame(); err == nil {
+			sent <- f
+		}
+	}()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := OpenConfig(client, config)
+		errs <- err
+		// Unblocks the server, if it is waiting on a frame never sent
+		client.Close()
+	}()
+
+	select {
+	case err := <-errs:
+		return <-sent, err
+	case <-time.After(5 * time.Second):
+		t.Fatal("opening the connection did not return")
+	}
+	return nil, nil
+}
+
+func TestOpenTuneFrameMax(t *testing.T) {
+	config := Config{FrameMax: defaultFrameMax, ChannelMax: defaultChannelMax}
+
+	// A usable frame max is accepted in TuneOk
+	f, _ := tuneWith(t, config, &proto.ConnectionTune{FrameMax: proto.FrameMinSize, ChannelMax: 10})
+	mf, ok := f.(*proto.MethodFrame)
+	if !ok {
+		t.Fatalf("sent %#v after the tune, want TuneOk", f)
+	}
+	tuneOk, ok := mf.Method.(*proto.ConnectionTuneOk)
+	if !ok {
+		t.Fatalf("sent %s after the tune, want TuneOk", mf.Method.MethodName())
+	}
+	if tuneOk.FrameMax != proto.FrameMinSize || tuneOk.ChannelMax != 10 {
+		t.Errorf("TuneOk frame max %d, channel max %d, want %d, 10", tuneOk.FrameMax, tuneOk.ChannelMax, proto.FrameMinSize)
+	}
+
+	// A frame max below the minimum is reported, and no TuneOk is sent
+	f, err := tuneWith(t, config, &proto.ConnectionTune{FrameMax: proto.FrameMinSize - 1, ChannelMax: 10})
+	if err != ErrFrameMaxValue {
+		t.Errorf("opening = %v, want %v", err, ErrFrameMaxValue)
+	}
+	if f != nil {
+		t.Errorf("sent %#v after a frame max below the minimum, want nothing", f)
+	}
+}
@@ -1,22 +1,37 @@
 package qclient
 
 import (
+	"time"
+
 	"github.com/sauravgsh16/message-server/proto"
 )
 
 // Delivery struct
 type Delivery struct {
 	// Properties
-	ContentType   string
-	MessageID     string
-	UserID        string
-	ApplicationID string
+	ContentType     string
+	ContentEncoding string
+	MessageID       string
+	CorrelationID   string
+	ReplyTo         string
+	UserID          string
+	ApplicationID   string
+	Type            string
+	Headers         proto.Table
+	DeliveryMode    uint8
+	Expiration      string
+	Priority        uint8
+	Timestamp       time.Time
 
 	ConsumerTag string
 	DeliveryTag uint64
+	Redelivered bool
 	Exchange    string
 	RoutingKey  string
 
+	// Messages remaining in queue, set for BasicGet
+	MessageCount uint32
+
 	// Payload
 	Body []byte
 }
@@ -24,18 +39,33 @@ type Delivery struct {
 func newDelivery(ch *Channel, mcf proto.MessageContentFrame) *Delivery {
 	props, body := mcf.GetContent()
 	d := &Delivery{
-		ContentType:   props.ContentType,
-		MessageID:     props.MessageID,
-		UserID:        props.UserID,
-		ApplicationID: props.ApplicationID,
-		Body:          body,
+		ContentType:     props.ContentType,
+		ContentEncoding: props.ContentEncoding,
+		MessageID:       props.MessageID,
+		CorrelationID:   props.CorrelationID,
+		ReplyTo:         props.ReplyTo,
+		UserID:          props.UserID,
+		ApplicationID:   props.ApplicationID,
+		Type:            props.Type,
+		Headers:         props.Headers,
+		DeliveryMode:    props.DeliveryMode,
+		Expiration:      props.Expiration,
+		Priority:        props.Priority,
+		Timestamp:       props.Timestamp,
+		Body:            body,
 	}
 
 	switch m := mcf.(type) {
-	// TODO: switch for BasicGet
+	case *proto.BasicGetOk:
+		d.DeliveryTag = m.DeliveryTag
+		d.Redelivered = m.Redelivered
+		d.Exchange = m.Exchange
+		d.RoutingKey = m.RoutingKey
+		d.MessageCount = m.MessageCount
 	case *proto.BasicDeliver:
 		d.ConsumerTag = m.ConsumerTag
 		d.DeliveryTag = m.DeliveryTag
+		d.Redelivered = m.Redelivered
 		d.Exchange = m.Exchange
 		d.RoutingKey = m.RoutingKey
 	}
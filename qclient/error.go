@@ -9,4 +9,5 @@ import (
 var (
 	ErrUnexpectedFrame = proto.NewHardError(505, "Unexpected Frame", 0, 0)
 	ErrClosed          = proto.NewHardError(504, "Communication attempt on close Channel/Connection", 0, 0)
+	ErrHeartbeat       = proto.NewHardError(501, "Missed heartbeats from server", 0, 0)
 )
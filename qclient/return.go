@@ -0,0 +1,57 @@
+package qclient
+
+import (
+	"time"
+
+	"github.com/sauravgsh16/message-server/proto"
+)
+
+// Return struct holds a published message, which the server returned
+// as it could not route the message to any queue
+type Return struct {
+	ReplyCode  uint16
+	ReplyText  string
+	Exchange   string
+	RoutingKey string
+
+	// Properties
+	ContentType     string
+	ContentEncoding string
+	MessageID       string
+	CorrelationID   string
+	ReplyTo         string
+	UserID          string
+	ApplicationID   string
+	Type            string
+	Headers         proto.Table
+	DeliveryMode    uint8
+	Expiration      string
+	Priority        uint8
+	Timestamp       time.Time
+
+	// Payload
+	Body []byte
+}
+
+func newReturn(m *proto.BasicReturn) Return {
+	return Return{
+		ReplyCode:       m.ReplyCode,
+		ReplyText:       m.ReplyText,
+		Exchange:        m.Exchange,
+		RoutingKey:      m.RoutingKey,
+		ContentType:     m.Properties.ContentType,
+		ContentEncoding: m.Properties.ContentEncoding,
+		MessageID:       m.Properties.MessageID,
+		CorrelationID:   m.Properties.CorrelationID,
+		ReplyTo:         m.Properties.ReplyTo,
+		UserID:          m.Properties.UserID,
+		ApplicationID:   m.Properties.ApplicationID,
+		Type:            m.Properties.Type,
+		Headers:         m.Properties.Headers,
+		DeliveryMode:    m.Properties.DeliveryMode,
+		Expiration:      m.Properties.Expiration,
+		Priority:        m.Properties.Priority,
+		Timestamp:       m.Properties.Timestamp,
+		Body:            m.Body,
+	}
+}
@@ -3,22 +3,39 @@ package binding
 import (
 	"bytes"
 	"crypto/sha1"
+	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 
 	"github.com/sauravgsh16/message-server/proto"
 )
 
-// Binding struct
+const (
+	xMatch    = "x-match"
+	xMatchAll = "all"
+	xMatchAny = "any"
+)
+
+// Binding struct. A binding routes messages from the exchange either
+// to the queue QueueName, or to the exchange DestExchange.
 type Binding struct {
-	ID        string
-	QueueName string
-	Exchange  string
-	Key       string
+	ID           string
+	QueueName    string
+	DestExchange string
+	Exchange     string
+	Key          string
+	Args         proto.Table
 }
 
-// NewBinding returns a binding struct of queue, exchange and routing key
-func NewBinding(queue, exchange, key string) (*Binding, error) {
-	id, err := calculateID(queue, exchange, key)
+// NewBinding returns a binding struct of queue, exchange, routing key and arguments
+func NewBinding(queue, exchange, key string, args proto.Table) (*Binding, error) {
+	id, err := calculateID(&proto.QueueBind{
+		Queue:      queue,
+		Exchange:   exchange,
+		RoutingKey: key,
+		Arguments:  args,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -27,10 +44,51 @@ func NewBinding(queue, exchange, key string) (*Binding, error) {
 		QueueName: queue,
 		Exchange:  exchange,
 		Key:       key,
+		Args:      args,
 		ID:        idStr,
 	}, nil
 }
 
+// NewExchangeBinding returns a binding struct of destination exchange,
+// source exchange, routing key and arguments
+func NewExchangeBinding(dest, source, key string, args proto.Table) (*Binding, error) {
+	id, err := calculateID(&proto.ExchangeBind{
+		Destination: dest,
+		Source:      source,
+		RoutingKey:  key,
+		Arguments:   args,
+	})
+	if err != nil {
+		return nil, err
+	}
+	idStr := fmt.Sprintf("%s", id)
+	return &Binding{
+		DestExchange: dest,
+		Exchange:     source,
+		Key:          key,
+		Args:         args,
+		ID:           idStr,
+	}, nil
+}
+
+// CheckArguments validates the arguments of a binding. x-match must be
+// all or any when given, so that a misspelt value is not taken as all.
+func CheckArguments(args proto.Table) error {
+	v, found := args[xMatch]
+	if !found {
+		return nil
+	}
+	if v != xMatchAll && v != xMatchAny {
+		return fmt.Errorf("%s must be %s or %s, got %v", xMatch, xMatchAll, xMatchAny, v)
+	}
+	return nil
+}
+
+// ToExchange returns true if the binding routes to an exchange
+func (b *Binding) ToExchange() bool {
+	return b.DestExchange != ""
+}
+
 // Equals check if two bindings are same
 func (b *Binding) Equals(b2 *Binding) bool {
 	if b.ID != b2.ID {
@@ -39,6 +97,9 @@ func (b *Binding) Equals(b2 *Binding) bool {
 	if b.QueueName != b2.QueueName {
 		return false
 	}
+	if b.DestExchange != b2.DestExchange {
+		return false
+	}
 	if b.Exchange != b2.Exchange {
 		return false
 	}
@@ -48,29 +109,126 @@ func (b *Binding) Equals(b2 *Binding) bool {
 	return true
 }
 
-// CheckDirectMatches checks if the binding exchange and routing key
-// matches with the exchange and routing key of the message for direct binding
-func (b *Binding) CheckDirectMatches(m *proto.BasicPublish) bool {
-	return b.Exchange == m.Exchange && b.Key == m.RoutingKey
+// CheckDirectMatches checks if the binding key matches
+// with the routing key of the message for direct binding.
+// The message may have been published to a different exchange,
+// which routed it here through an exchange binding.
+func (b *Binding) CheckDirectMatches(routingKey string) bool {
+	return b.Key == routingKey
+}
+
+// CheckHeadersMatches checks if the message headers match the binding
+// arguments for headers binding. Arguments starting with 'x-' are not matched.
+// x-match=all (default) needs all arguments to match, x-match=any needs one.
+// Other x-match values are rejected by CheckArguments on binding.
+// An argument with a void value matches on presence of the header.
+func (b *Binding) CheckHeadersMatches(headers proto.Table) bool {
+	matchAll := b.Args[xMatch] != xMatchAny
+
+	for k, v := range b.Args {
+		if strings.HasPrefix(k, "x-") {
+			continue
+		}
+		hv, found := headers[k]
+		matched := found && (v == nil || fieldEquals(v, hv))
+
+		if matched && !matchAll {
+			return true
+		}
+		if !matched && matchAll {
+			return false
+		}
+	}
+	return matchAll
 }
 
-// CheckFanoutMatches checks if the binding exchange
-// matches with the exchange of the message for fanout binding
-func (b *Binding) CheckFanoutMatches(m *proto.BasicPublish) bool {
-	return b.Exchange == m.Exchange
+// fieldEquals compares two field values, treating integers of different sizes alike
+func fieldEquals(a, b interface{}) bool {
+	return reflect.DeepEqual(normaliseField(a), normaliseField(b))
 }
 
-func calculateID(queue, exchange, key string) ([]byte, error) {
-	qb := &proto.QueueBind{
-		Queue:      queue,
-		Exchange:   exchange,
-		RoutingKey: key,
+func normaliseField(v interface{}) interface{} {
+	if i, ok := proto.IntValue(v); ok {
+		return i
 	}
+	return v
+}
+
+// Encode returns the binding encoded as the method which declares it
+func (b *Binding) Encode() ([]byte, error) {
+	return encodeMethod(b.method())
+}
+
+// Decode returns the binding from its encoding by Encode
+func Decode(data []byte) (*Binding, error) {
+	r := bytes.NewReader(data)
+
+	clsID, err := proto.ReadShort(r)
+	if err != nil {
+		return nil, errors.New("could not read class id of binding: " + err.Error())
+	}
+	mtdID, err := proto.ReadShort(r)
+	if err != nil {
+		return nil, errors.New("could not read method id of binding: " + err.Error())
+	}
+
+	qb := &proto.QueueBind{}
+	if cls, mtd := qb.Identifier(); cls == clsID && mtd == mtdID {
+		if err := qb.Read(r); err != nil {
+			return nil, err
+		}
+		return NewBinding(qb.Queue, qb.Exchange, qb.RoutingKey, qb.Arguments)
+	}
+
+	eb := &proto.ExchangeBind{}
+	if cls, mtd := eb.Identifier(); cls == clsID && mtd == mtdID {
+		if err := eb.Read(r); err != nil {
+			return nil, err
+		}
+		return NewExchangeBinding(eb.Destination, eb.Source, eb.RoutingKey, eb.Arguments)
+	}
+
+	return nil, fmt.Errorf("unknown binding method: %d, %d", clsID, mtdID)
+}
+
+func (b *Binding) method() proto.MessageFrame {
+	if b.ToExchange() {
+		return &proto.ExchangeBind{
+			Destination: b.DestExchange,
+			Source:      b.Exchange,
+			RoutingKey:  b.Key,
+			Arguments:   b.Args,
+		}
+	}
+	return &proto.QueueBind{
+		Queue:      b.QueueName,
+		Exchange:   b.Exchange,
+		RoutingKey: b.Key,
+		Arguments:  b.Args,
+	}
+}
+
+// encodeMethod writes the classID and MethodID followed by the method
+func encodeMethod(mf proto.MessageFrame) ([]byte, error) {
 	buf := bytes.NewBuffer(make([]byte, 0))
-	qb.Write(buf)
 
-	// After writing, we know that the first four bytes will be the classID and MethodID
-	val := buf.Bytes()[4:]
+	cls, mtd := mf.Identifier()
+	proto.WriteShort(buf, cls)
+	proto.WriteShort(buf, mtd)
+	if err := mf.Write(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func calculateID(mf proto.MessageFrame) ([]byte, error) {
+	// The classID and MethodID are part of the encoding, so that
+	// queue and exchange bindings with the same names differ
+	val, err := encodeMethod(mf)
+	if err != nil {
+		return make([]byte, 0), err
+	}
+
 	// We then hash the bytes
 	hash := sha1.New()
 	if _, err := hash.Write(val); err != nil {
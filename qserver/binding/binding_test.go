@@ -0,0 +1,145 @@
+package binding
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sauravgsh16/message-server/proto"
+)
+
+func TestCheckArguments(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    proto.Table
+		wantErr bool
+	}{
+		{"no arguments", nil, false},
+		{"no x-match", proto.Table{"format": "pdf"}, false},
+		{"all", proto.Table{"x-match": "all"}, false},
+		{"any", proto.Table{"x-match": "any"}, false},
+		{"capitalised", proto.Table{"x-match": "Any"}, true},
+		{"misspelt", proto.Table{"x-match": "anny"}, true},
+		{"empty", proto.Table{"x-match": ""}, true},
+		{"not a string", proto.Table{"x-match": int32(1)}, true},
+		{"void", proto.Table{"x-match": nil}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckArguments(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckArguments(%v) = %v, want error %v", tt.args, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckHeadersMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    proto.Table
+		headers proto.Table
+		want    bool
+	}{
+		{"all matching", proto.Table{"a": "1", "b": "2"}, proto.Table{"a": "1", "b": "2"}, true},
+		{"all by default", proto.Table{"a": "1", "b": "2"}, proto.Table{"a": "1"}, false},
+		{"all explicit", proto.Table{"x-match": "all", "a": "1", "b": "2"}, proto.Table{"a": "1"}, false},
+		{"all with extra headers", proto.Table{"a": "1"}, proto.Table{"a": "1", "c": "3"}, true},
+		{"all different value", proto.Table{"a": "1"}, proto.Table{"a": "2"}, false},
+		{"any one matching", proto.Table{"x-match": "any", "a": "1", "b": "2"}, proto.Table{"b": "2"}, true},
+		{"any none matching", proto.Table{"x-match": "any", "a": "1", "b": "2"}, proto.Table{"a": "2", "c": "3"}, false},
+		{"any without arguments", proto.Table{"x-match": "any"}, proto.Table{"a": "1"}, false},
+		{"all without arguments", proto.Table{}, proto.Table{"a": "1"}, true},
+		{"x- arguments not matched", proto.Table{"x-other": "v", "a": "1"}, proto.Table{"a": "1"}, true},
+		{"void matches presence", proto.Table{"a": nil}, proto.Table{"a": "anything"}, true},
+		{"void needs presence", proto.Table{"a": nil}, proto.Table{"b": "1"}, false},
+		{"integer sizes alike", proto.Table{"n": int8(5)}, proto.Table{"n": int64(5)}, true},
+		{"integer differs", proto.Table{"n": int32(5)}, proto.Table{"n": int32(6)}, false},
+		{"string is not an integer", proto.Table{"n": "5"}, proto.Table{"n": int32(5)}, false},
+		{"missing headers", proto.Table{"a": "1"}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewBinding("q", "headers", "", tt.args)
+			if err != nil {
+				t.Fatalf("NewBinding: %v", err)
+			}
+			if got := b.CheckHeadersMatches(tt.headers); got != tt.want {
+				t.Errorf("CheckHeadersMatches(%v) with arguments %v = %v, want %v", tt.headers, tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	args := proto.Table{"x-match": "any", "format": "pdf", "size": int32(10)}
+
+	queueBinding, err := NewBinding("jobs", "logs", "a.#", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exchangeBinding, err := NewExchangeBinding("archive", "logs", "a.#", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noArgs, err := NewBinding("jobs", "logs", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, b := range []*Binding{queueBinding, exchangeBinding, noArgs} {
+		data, err := b.Encode()
+		if err != nil {
+			t.Fatalf("Encode() = %v", err)
+		}
+		got, err := Decode(data)
+		if err != nil {
+			t.Fatalf("Decode() = %v", err)
+		}
+		if !got.Equals(b) || got.ToExchange() != b.ToExchange() {
+			t.Errorf("Decode() = %+v, want %+v", got, b)
+		}
+		if len(b.Args) > 0 && !reflect.DeepEqual(got.Args, b.Args) {
+			t.Errorf("Decode() arguments = %v, want %v", got.Args, b.Args)
+		}
+	}
+
+	// Queue and exchange bindings of the same names are told apart
+	if queueBinding.ID == exchangeBinding.ID {
+		t.Error("queue and exchange binding have the same id")
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	b, err := NewBinding("jobs", "logs", "key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := b.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := encodeMethod(&proto.QueueDeclare{Queue: "jobs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"no method id", data[:2]},
+		{"truncated method", data[:len(data)-1]},
+		{"not a binding", other},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := Decode(tt.data); err == nil {
+				t.Errorf("Decode() = %+v, want an error", got)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package consumer
 
 import (
+	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/sauravgsh16/message-server/proto"
@@ -19,11 +21,18 @@ type Consumer struct {
 	stopped     bool
 	stopMux     sync.Mutex
 	noAck       bool
-	defaultSize uint32
+	qos         Qos
 	activeSize  uint32
+	activeCount uint16
 	sizeMux     sync.Mutex
 }
 
+// Qos struct holds the prefetch limits of a consumer. A zero limit means no limit.
+type Qos struct {
+	PrefetchSize  uint32
+	PrefetchCount uint16
+}
+
 // ConsumerQueue interface
 type ConsumerQueue interface {
 	GetOne(mrh ...proto.MessageResourceHolder) (*proto.QueueMessage, *proto.Message)
@@ -36,25 +45,47 @@ type ChannelResource interface {
 	Send(mf proto.MessageFrame) error
 	FlowActive() bool
 	GetDeliveryTag() uint64
+	AddUnackedMessage(tag uint64, c *Consumer, qm *proto.QueueMessage, queueName string)
+}
+
+// CheckArguments validates the arguments of basic.consume. No consume
+// arguments are supported, so that clients relying on one are told so.
+func CheckArguments(args proto.Table) error {
+	keys := make([]string, 0, len(args))
+	for key := range args {
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+	return fmt.Errorf("unsupported consume argument %s", keys[0])
 }
 
 // NewConsumer returns a new consumer
-func NewConsumer(ms *store.MsgStore, cr ChannelResource, consumerTag string, cq ConsumerQueue, queueName string, noAck bool, defaultSize uint32) *Consumer {
+func NewConsumer(ms *store.MsgStore, cr ChannelResource, consumerTag string, cq ConsumerQueue, queueName string, noAck bool, qos Qos) *Consumer {
 	return &Consumer{
 		msgStore:    ms,
 		ConsumerTag: consumerTag,
 		chResource:  cr,
-		incoming:    make(chan bool),
+		incoming:    make(chan bool, 1),
 		cQueue:      cq,
 		queueName:   queueName,
 		noAck:       noAck,
-		defaultSize: defaultSize,
+		qos:         qos,
 	}
 }
 
+// QueueName returns the name of the queue the consumer consumes from
+func (c *Consumer) QueueName() string {
+	return c.queueName
+}
+
 // Start consumption
 func (c *Consumer) Start() {
 	go c.consume()
+	// Messages might already be waiting in the queue
+	c.Ping()
 }
 
 // Stop consumption
@@ -81,7 +112,7 @@ func (c *Consumer) Ping() {
 	}
 }
 
-// AcquireResources checks queue for size
+// AcquireResources checks the consumer prefetch limits for size and count
 func (c *Consumer) AcquireResources(qm *proto.QueueMessage) bool {
 
 	c.sizeMux.Lock()
@@ -93,25 +124,28 @@ func (c *Consumer) AcquireResources(qm *proto.QueueMessage) bool {
 		return false
 	}
 
-	if c.noAck {
-		c.activeSize += qm.MsgSize
-		return true
+	if !c.noAck {
+		if c.qos.PrefetchCount > 0 && c.activeCount >= c.qos.PrefetchCount {
+			return false
+		}
+		if c.qos.PrefetchSize > 0 && c.activeSize >= c.qos.PrefetchSize {
+			return false
+		}
 	}
 
-	if c.activeSize < c.defaultSize {
-		c.activeSize += qm.MsgSize
-		return true
-	}
-	return false
+	c.activeSize += qm.MsgSize
+	c.activeCount++
+	return true
 }
 
-// ReleaseResources decreases the active size count
+// ReleaseResources decreases the active size and count
 func (c *Consumer) ReleaseResources(qm *proto.QueueMessage) {
 
 	c.sizeMux.Lock()
 	defer c.sizeMux.Unlock()
 
 	c.activeSize -= qm.MsgSize
+	c.activeCount--
 }
 
 // SendCancel sends a cancel call
@@ -127,18 +161,18 @@ func (c *Consumer) ConsumeImmediate(msg *proto.Message, qm *proto.QueueMessage)
 	c.mux.Lock()
 	defer c.mux.Unlock()
 
-	var tag uint64 = 0
+	tag := c.chResource.GetDeliveryTag()
+
+	if c.noAck {
+		c.msgStore.RemoveRef(qm, c.queueName, c.ResourceHolders())
+	} else {
+		c.chResource.AddUnackedMessage(tag, c, qm, c.queueName)
+	}
 
-	// TODO:
-	/*
-		        // qm used here
-			if !c.noAck {
-				tag := c.chResource.ADDUNACKMESSAGE()
-			}
-	*/
 	c.chResource.SendContent(&proto.BasicDeliver{
 		ConsumerTag: c.ConsumerTag,
 		DeliveryTag: tag,
+		Redelivered: qm.DeliveryCount > 0,
 		Exchange:    msg.Exchange,
 		RoutingKey:  msg.RoutingKey,
 	}, msg)
@@ -160,8 +194,6 @@ func (c *Consumer) consumeOne() {
 	c.mux.Lock()
 	defer c.mux.Unlock()
 
-	deliveryTag := c.chResource.GetDeliveryTag()
-
 	qm, msg := c.cQueue.GetOne(c.chResource, c)
 
 	if qm == nil {
@@ -179,25 +211,24 @@ func (c *Consumer) consumeOne() {
 		*/
 	}
 
+	deliveryTag := c.chResource.GetDeliveryTag()
+
 	if c.noAck {
+		// We remove the reference of this message from the msg store
+		// as we will not see this message anymore.
 		rhs := c.ResourceHolders()
 		if err := c.msgStore.RemoveRef(qm, c.queueName, rhs); err != nil {
 			panic("Error when trying to remove msg references")
 		}
+	} else {
+		// Message is held by the channel till the client acknowledges it
+		c.chResource.AddUnackedMessage(deliveryTag, c, qm, c.queueName)
 	}
-	/*
-		TODO
-		if !c.noAck {
-			We need to add this to a list of messages which have not
-			been acknowledged yet.
-		} else {
-			We remove the reference of this message from the msg store
-			as we will not see this message anymore.
-		}
-	*/
+
 	c.chResource.SendContent(&proto.BasicDeliver{
 		ConsumerTag: c.ConsumerTag,
 		DeliveryTag: deliveryTag,
+		Redelivered: qm.DeliveryCount > 0,
 		Exchange:    msg.Exchange,
 		RoutingKey:  msg.RoutingKey,
 	}, msg)
@@ -0,0 +1,33 @@
+package consumer
+
+import (
+	"testing"
+
+	"github.com/sauravgsh16/message-server/proto"
+)
+
+func TestCheckArguments(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    proto.Table
+		wantErr string
+	}{
+		{"no arguments", nil, ""},
+		{"empty arguments", proto.Table{}, ""},
+		{"priority", proto.Table{"x-priority": int32(5)}, "unsupported consume argument x-priority"},
+		// The first argument by name is reported, so the error does not change between calls
+		{"several", proto.Table{"x-priority": int32(5), "x-cancel-on-ha-failover": true}, "unsupported consume argument x-cancel-on-ha-failover"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckArguments(tt.args)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("CheckArguments(%v) = %v, want nil", tt.args, err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("CheckArguments(%v) = %v, want %s", tt.args, err, tt.wantErr)
+			}
+		})
+	}
+}
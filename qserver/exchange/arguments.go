@@ -0,0 +1,33 @@
+package exchange
+
+import (
+	"fmt"
+
+	"github.com/sauravgsh16/message-server/proto"
+)
+
+// Exchange arguments given in exchange declare
+const (
+	ArgAlternateExchange = "alternate-exchange"
+)
+
+// SetArguments validates the exchange declare arguments and applies them to the exchange
+func (ex *Exchange) SetArguments(args proto.Table) error {
+	var ae string
+	if v, found := args[ArgAlternateExchange]; found {
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("invalid %s: expected string, got %T", ArgAlternateExchange, v)
+		}
+		ae = s
+	}
+
+	ex.Args = args
+	ex.AlternateExchange = ae
+	return nil
+}
+
+// EqualArguments returns true if the arguments are the ones the exchange was declared with
+func (ex *Exchange) EqualArguments(args proto.Table) bool {
+	return proto.EqualTables(ex.Args, args)
+}
@@ -12,24 +12,33 @@ const (
 	EX_DIRECT  uint8 = 1
 	EX_FANOUT  uint8 = 2
 	EX_HEADERS uint8 = 3
+	EX_TOPIC   uint8 = 4
 )
 
 type Exchange struct {
-	Name       string
-	ExType     uint8
-	bindings   []*binding.Binding
-	bindLock   sync.Mutex
-	Closed     bool
-	deleteChan chan *Exchange
+	Name              string
+	ExType            uint8
+	Durable           bool
+	Args              proto.Table
+	AlternateExchange string
+	bindings          []*binding.Binding
+	bindLock          sync.Mutex
+	Closed            bool
+	deleteChan        chan *Exchange
+	topics            *topicTrie
 }
 
 func NewExchange(name string, extype uint8, deleteChan chan *Exchange) *Exchange {
-	return &Exchange{
+	ex := &Exchange{
 		Name:       name,
 		ExType:     extype,
 		bindings:   make([]*binding.Binding, 0),
 		deleteChan: deleteChan,
 	}
+	if extype == EX_TOPIC {
+		ex.topics = newTopicTrie()
+	}
+	return ex
 }
 
 func NewExchangeFromMethod(m *proto.ExchangeDeclare, exDeleter chan *Exchange) (*Exchange, *proto.Error) {
@@ -40,6 +49,11 @@ func NewExchangeFromMethod(m *proto.ExchangeDeclare, exDeleter chan *Exchange) (
 	}
 
 	ex := NewExchange(m.Exchange, extype, exDeleter)
+	ex.Durable = m.Durable
+	if err := ex.SetArguments(m.Arguments); err != nil {
+		clsID, mtdID := m.Identifier()
+		return nil, proto.NewSoftError(406, err.Error(), clsID, mtdID)
+	}
 	return ex, nil
 }
 
@@ -53,13 +67,31 @@ func GetExType(extype string) (uint8, error) {
 		return EX_DIRECT, nil
 	case "fanout":
 		return EX_FANOUT, nil
-	case "header":
+	case "header", "headers":
 		return EX_HEADERS, nil
+	case "topic":
+		return EX_TOPIC, nil
 	default:
 		return 0, fmt.Errorf("unknown exchange type: %s", extype)
 	}
 }
 
+// ExTypeName returns the name an exchange type is declared with
+func ExTypeName(extype uint8) string {
+	switch extype {
+	case EX_DIRECT:
+		return "direct"
+	case EX_FANOUT:
+		return "fanout"
+	case EX_HEADERS:
+		return "headers"
+	case EX_TOPIC:
+		return "topic"
+	default:
+		return ""
+	}
+}
+
 func (ex *Exchange) AddBinding(b *binding.Binding, connID int64) error {
 	ex.bindLock.Lock()
 	defer ex.bindLock.Unlock()
@@ -72,6 +104,9 @@ func (ex *Exchange) AddBinding(b *binding.Binding, connID int64) error {
 	}
 
 	ex.bindings = append(ex.bindings, b)
+	if ex.topics != nil {
+		ex.topics.add(b)
+	}
 	return nil
 }
 
@@ -82,8 +117,11 @@ func (ex *Exchange) RemoveBinding(b *binding.Binding) error {
 	for i, bind := range ex.bindings {
 		if b.Equals(bind) {
 			ex.bindings = append(ex.bindings[:i], ex.bindings[i+1:]...)
+			if ex.topics != nil {
+				ex.topics.remove(bind)
+			}
+			return nil
 		}
-		return nil
 	}
 	return nil
 }
@@ -96,37 +134,130 @@ func (ex *Exchange) RemoveQueueBindings(qname string) {
 	for _, b := range ex.bindings {
 		if b.QueueName != qname {
 			bindings = append(bindings, b)
+		} else if ex.topics != nil {
+			ex.topics.remove(b)
+		}
+	}
+	ex.bindings = bindings
+}
+
+// BindingCount returns the number of queues and exchanges bound to the exchange
+func (ex *Exchange) BindingCount() uint32 {
+	ex.bindLock.Lock()
+	defer ex.bindLock.Unlock()
+
+	return uint32(len(ex.bindings))
+}
+
+// RemoveExchangeBindings removes all bindings to the destination exchange
+func (ex *Exchange) RemoveExchangeBindings(dest string) {
+	bindings := make([]*binding.Binding, 0)
+	ex.bindLock.Lock()
+	defer ex.bindLock.Unlock()
+
+	for _, b := range ex.bindings {
+		if b.DestExchange != dest {
+			bindings = append(bindings, b)
+		} else if ex.topics != nil {
+			ex.topics.remove(b)
 		}
 	}
 	ex.bindings = bindings
 }
 
-func (ex *Exchange) QueuesToPublish(msg *proto.Message) ([]string, *proto.Error) {
+// QueuesToPublish returns the queues the message is routed to. Messages are routed
+// further through exchanges bound to the exchange, which are resolved with lookup.
+// Each exchange routes the message once, so cycles of exchange bindings end.
+// Messages the exchange cannot route are routed by its alternate exchange, and
+// on by the alternate exchange of that one, till the chain comes back to an exchange tried before.
+func (ex *Exchange) QueuesToPublish(msg *proto.Message, lookup func(name string) (*Exchange, bool)) ([]string, *proto.Error) {
 	clsID, mtdID := msg.Method.Identifier()
-	queues := make([]string, 0)
 	if ex.Name != msg.Method.(*proto.BasicPublish).Exchange {
-		return queues, proto.NewSoftError(404, "Exchange name MisMatch", clsID, mtdID)
+		return make([]string, 0), proto.NewSoftError(404, "Exchange name MisMatch", clsID, mtdID)
 	}
 
+	queues := ex.route(msg, lookup)
+
+	tried := map[string]bool{ex.Name: true}
+	cur := ex
+	for len(queues) == 0 && len(cur.AlternateExchange) > 0 && !tried[cur.AlternateExchange] {
+		ae, found := lookup(cur.AlternateExchange)
+		if !found || ae.Closed {
+			break
+		}
+		tried[ae.Name] = true
+		queues = ae.route(msg, lookup)
+		cur = ae
+	}
+
+	return queues, nil
+}
+
+// route returns the queues the exchange and the exchanges bound to it route the message to
+func (ex *Exchange) route(msg *proto.Message, lookup func(name string) (*Exchange, bool)) []string {
+	queues := make([]string, 0)
+	visited := make(map[string]bool)
+	seen := make(map[string]bool)
+
+	pending := []*Exchange{ex}
+	visited[ex.Name] = true
+
+	for len(pending) > 0 {
+		cur := pending[0]
+		pending = pending[1:]
+
+		for _, b := range cur.matchBindings(msg) {
+			if !b.ToExchange() {
+				if !seen[b.QueueName] {
+					seen[b.QueueName] = true
+					queues = append(queues, b.QueueName)
+				}
+				continue
+			}
+
+			if visited[b.DestExchange] {
+				continue
+			}
+			visited[b.DestExchange] = true
+
+			dest, found := lookup(b.DestExchange)
+			if !found || dest.Closed {
+				continue
+			}
+			pending = append(pending, dest)
+		}
+	}
+
+	return queues
+}
+
+// matchBindings returns the bindings of the exchange which match the message
+func (ex *Exchange) matchBindings(msg *proto.Message) []*binding.Binding {
+	ex.bindLock.Lock()
+	defer ex.bindLock.Unlock()
+
+	matched := make([]*binding.Binding, 0)
+
 	switch {
 	case ex.ExType == EX_DIRECT:
 		for _, b := range ex.bindings {
-			if b.CheckDirectMatches(msg.Method.(*proto.BasicPublish)) {
-				queues = append(queues, b.QueueName)
-				return queues, nil
+			if b.CheckDirectMatches(msg.RoutingKey) {
+				matched = append(matched, b)
 			}
 		}
 	case ex.ExType == EX_FANOUT:
+		matched = append(matched, ex.bindings...)
+	case ex.ExType == EX_TOPIC:
+		matched = ex.topics.match(msg.RoutingKey)
+	case ex.ExType == EX_HEADERS:
 		for _, b := range ex.bindings {
-			if b.CheckDirectMatches(msg.Method.(*proto.BasicPublish)) {
-				queues = append(queues, b.QueueName)
+			if b.CheckHeadersMatches(msg.Header.Properties.Headers) {
+				matched = append(matched, b)
 			}
 		}
-	// TODO:
-	// case ex.ExType == EX_HEADERS
 	default:
 		panic("Exchange type unknown")
 	}
 
-	return queues, nil
+	return matched
 }
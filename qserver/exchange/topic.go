@@ -0,0 +1,144 @@
+package exchange
+
+import (
+	"strings"
+
+	"github.com/sauravgsh16/message-server/qserver/binding"
+)
+
+const (
+	topicSeparator = "."
+	matchOneWord   = "*"
+	matchAnyWords  = "#"
+)
+
+// topicNode struct represents a single word of a binding key
+type topicNode struct {
+	children map[string]*topicNode
+	bindings []*binding.Binding
+}
+
+// topicTrie struct holds the bindings of a topic exchange,
+// indexed word by word on their binding keys
+type topicTrie struct {
+	root *topicNode
+}
+
+func newTopicNode() *topicNode {
+	return &topicNode{
+		children: make(map[string]*topicNode),
+		bindings: make([]*binding.Binding, 0),
+	}
+}
+
+func newTopicTrie() *topicTrie {
+	return &topicTrie{root: newTopicNode()}
+}
+
+func splitTopic(key string) []string {
+	if len(key) == 0 {
+		return []string{}
+	}
+	return strings.Split(key, topicSeparator)
+}
+
+func (t *topicTrie) add(b *binding.Binding) {
+	node := t.root
+	for _, word := range splitTopic(b.Key) {
+		child, found := node.children[word]
+		if !found {
+			child = newTopicNode()
+			node.children[word] = child
+		}
+		node = child
+	}
+	node.bindings = append(node.bindings, b)
+}
+
+func (t *topicTrie) remove(b *binding.Binding) {
+	t.root.remove(b, splitTopic(b.Key))
+}
+
+// remove deletes the binding from the trie, returning true if the node
+// is left without any bindings or children, and can thus be pruned
+func (n *topicNode) remove(b *binding.Binding, words []string) bool {
+	if len(words) == 0 {
+		for i, bind := range n.bindings {
+			if b.Equals(bind) {
+				n.bindings = append(n.bindings[:i], n.bindings[i+1:]...)
+				break
+			}
+		}
+	} else if child, found := n.children[words[0]]; found {
+		if child.remove(b, words[1:]) {
+			delete(n.children, words[0])
+		}
+	}
+	return len(n.bindings) == 0 && len(n.children) == 0
+}
+
+// topicMatch holds the state of matching a routing key against the trie
+type topicMatch struct {
+	words   []string
+	matched map[string]*binding.Binding
+	// visited records the nodes matched at each word offset. A node is
+	// reached at the same offset along many paths when the binding key
+	// holds several '#', and matching it again finds nothing new.
+	visited map[topicVisit]bool
+}
+
+type topicVisit struct {
+	node   *topicNode
+	offset int
+}
+
+// match returns all bindings whose keys match the routing key
+func (t *topicTrie) match(routingKey string) []*binding.Binding {
+	m := &topicMatch{
+		words:   splitTopic(routingKey),
+		matched: make(map[string]*binding.Binding),
+		visited: make(map[topicVisit]bool),
+	}
+	t.root.match(m, 0)
+
+	bindings := make([]*binding.Binding, 0, len(m.matched))
+	for _, b := range m.matched {
+		bindings = append(bindings, b)
+	}
+	return bindings
+}
+
+// match matches the node against the words of the routing key from offset on
+func (n *topicNode) match(m *topicMatch, offset int) {
+	visit := topicVisit{node: n, offset: offset}
+	if m.visited[visit] {
+		return
+	}
+	m.visited[visit] = true
+
+	if offset == len(m.words) {
+		for _, b := range n.bindings {
+			m.matched[b.ID] = b
+		}
+		// '#' matches zero words as well
+		if child, found := n.children[matchAnyWords]; found {
+			child.match(m, offset)
+		}
+		return
+	}
+
+	if child, found := n.children[m.words[offset]]; found {
+		child.match(m, offset+1)
+	}
+
+	if child, found := n.children[matchOneWord]; found {
+		child.match(m, offset+1)
+	}
+
+	if child, found := n.children[matchAnyWords]; found {
+		// '#' consumes zero or more words
+		for i := offset; i <= len(m.words); i++ {
+			child.match(m, i)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package exchange
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sauravgsh16/message-server/qserver/binding"
+)
+
+// newTestTrie returns a trie with a binding for each key, bound to a queue named after the key
+func newTestTrie(t *testing.T, keys ...string) (*topicTrie, map[string]*binding.Binding) {
+	trie := newTopicTrie()
+	bindings := make(map[string]*binding.Binding)
+	for _, key := range keys {
+		b, err := binding.NewBinding("q:"+key, "topic", key, nil)
+		if err != nil {
+			t.Fatalf("NewBinding(%q): %v", key, err)
+		}
+		trie.add(b)
+		bindings[key] = b
+	}
+	return trie, bindings
+}
+
+// matchedKeys returns the sorted binding keys matching the routing key
+func matchedKeys(trie *topicTrie, routingKey string) []string {
+	keys := make([]string, 0)
+	for _, b := range trie.match(routingKey) {
+		keys = append(keys, b.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestTopicMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		bindings   []string
+		routingKey string
+		want       []string
+	}{
+		{"exact", []string{"a.b", "a.c"}, "a.b", []string{"a.b"}},
+		{"exact no match", []string{"a.b"}, "a.b.c", []string{}},
+		{"prefix is not a match", []string{"a.b.c"}, "a.b", []string{}},
+		{"star matches one word", []string{"a.*"}, "a.b", []string{"a.*"}},
+		{"star does not match zero words", []string{"a.*"}, "a", []string{}},
+		{"star does not match two words", []string{"a.*"}, "a.b.c", []string{}},
+		{"star in the middle", []string{"a.*.c"}, "a.b.c", []string{"a.*.c"}},
+		{"lone star", []string{"*"}, "a", []string{"*"}},
+		{"lone star no words", []string{"*"}, "", []string{}},
+		{"hash matches zero words", []string{"a.#"}, "a", []string{"a.#"}},
+		{"hash matches one word", []string{"a.#"}, "a.b", []string{"a.#"}},
+		{"hash matches many words", []string{"a.#"}, "a.b.c.d", []string{"a.#"}},
+		{"leading hash", []string{"#.c"}, "a.b.c", []string{"#.c"}},
+		{"leading hash zero words", []string{"#.c"}, "c", []string{"#.c"}},
+		{"hash in the middle", []string{"a.#.c"}, "a.c", []string{"a.#.c"}},
+		{"hash in the middle many", []string{"a.#.c"}, "a.b.b.c", []string{"a.#.c"}},
+		{"hash in the middle no tail", []string{"a.#.c"}, "a.b", []string{}},
+		{"lone hash", []string{"#"}, "a.b.c", []string{"#"}},
+		{"lone hash empty key", []string{"#"}, "", []string{"#"}},
+		{"empty binding key", []string{""}, "", []string{""}},
+		{"empty binding key no match", []string{""}, "a", []string{}},
+		{"empty word", []string{"a..b"}, "a..b", []string{"a..b"}},
+		{"star matches empty word", []string{"a.*.b"}, "a..b", []string{"a.*.b"}},
+		{"trailing empty word", []string{"a.*"}, "a.", []string{"a.*"}},
+		{"hash then star", []string{"#.*"}, "a", []string{"#.*"}},
+		{"hash then star needs a word", []string{"#.*"}, "", []string{}},
+		{"hash matches once per binding", []string{"#.#"}, "a.b", []string{"#.#"}},
+		{"several hashes", []string{"#.a.#.b.#"}, "x.a.y.b.z", []string{"#.a.#.b.#"}},
+		{"several hashes zero words", []string{"#.a.#.b.#"}, "a.b", []string{"#.a.#.b.#"}},
+		{"several hashes no match", []string{"#.a.#.b.#"}, "b.a", []string{}},
+		{"adjacent hashes", []string{"#.#.#.x"}, "a.b.x", []string{"#.#.#.x"}},
+		{"adjacent hashes no match", []string{"#.#.#.x"}, "a.b.y", []string{}},
+		{
+			"several bindings",
+			[]string{"a.b", "a.*", "a.#", "#", "*.b", "b.#", "*"},
+			"a.b",
+			[]string{"#", "*.b", "a.#", "a.*", "a.b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trie, _ := newTestTrie(t, tt.bindings...)
+			got := matchedKeys(trie, tt.routingKey)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("match(%q) with bindings %q = %q, want %q", tt.routingKey, tt.bindings, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopicMatchManyHashesLongKey(t *testing.T) {
+	// Without memoizing, each '#' retries every suffix of the routing
+	// key, and this takes words^hashes steps
+	trie, _ := newTestTrie(t, "#.#.#.#.#.#.#.#.x", "#.a.#.a.#.a.#.a.#")
+	words := make([]string, 200)
+	for i := range words {
+		words[i] = "a"
+	}
+	routingKey := strings.Join(words, ".")
+
+	done := make(chan []string, 1)
+	go func() {
+		done <- matchedKeys(trie, routingKey)
+	}()
+
+	select {
+	case got := <-done:
+		if want := []string{"#.a.#.a.#.a.#.a.#"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("match = %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("matching a long routing key against several '#' did not finish")
+	}
+}
+
+func TestTopicMatchDuplicateBindings(t *testing.T) {
+	trie := newTopicTrie()
+	q1, _ := binding.NewBinding("q1", "topic", "a.*", nil)
+	q2, _ := binding.NewBinding("q2", "topic", "a.*", nil)
+	trie.add(q1)
+	trie.add(q2)
+
+	got := trie.match("a.b")
+	if len(got) != 2 {
+		t.Fatalf("match returned %d bindings, want 2", len(got))
+	}
+}
+
+func TestTopicRemove(t *testing.T) {
+	tests := []struct {
+		name       string
+		bindings   []string
+		remove     []string
+		routingKey string
+		want       []string
+	}{
+		{"remove only binding", []string{"a.b"}, []string{"a.b"}, "a.b", []string{}},
+		{"remove keeps siblings", []string{"a.b", "a.*"}, []string{"a.b"}, "a.b", []string{"a.*"}},
+		{"remove keeps descendants", []string{"a", "a.b"}, []string{"a"}, "a.b", []string{"a.b"}},
+		{"remove keeps ancestors", []string{"a", "a.b"}, []string{"a.b"}, "a", []string{"a"}},
+		{"remove hash", []string{"#", "a.#"}, []string{"#"}, "a.b", []string{"a.#"}},
+		{"remove all", []string{"a.b", "a.*", "#"}, []string{"a.b", "a.*", "#"}, "a.b", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trie, bindings := newTestTrie(t, tt.bindings...)
+			for _, key := range tt.remove {
+				trie.remove(bindings[key])
+			}
+			got := matchedKeys(trie, tt.routingKey)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("match(%q) after removing %q = %q, want %q", tt.routingKey, tt.remove, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopicRemovePrunesNodes(t *testing.T) {
+	trie, bindings := newTestTrie(t, "a.b.c", "a.x")
+	trie.remove(bindings["a.b.c"])
+
+	a := trie.root.children["a"]
+	if a == nil {
+		t.Fatal("node a was pruned while a.x is still bound")
+	}
+	if _, found := a.children["b"]; found {
+		t.Error("node a.b was not pruned")
+	}
+
+	trie.remove(bindings["a.x"])
+	if len(trie.root.children) != 0 {
+		t.Errorf("root has %d children after removing all bindings, want 0", len(trie.root.children))
+	}
+}
+
+func TestTopicRemoveUnknownBinding(t *testing.T) {
+	trie, _ := newTestTrie(t, "a.b")
+	other, _ := binding.NewBinding("other", "topic", "a.b", nil)
+	missing, _ := binding.NewBinding("missing", "topic", "x.y", nil)
+
+	trie.remove(other)
+	trie.remove(missing)
+
+	got := matchedKeys(trie, "a.b")
+	if !reflect.DeepEqual(got, []string{"a.b"}) {
+		t.Errorf("match(%q) = %q, want %q", "a.b", got, []string{"a.b"})
+	}
+}
@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sauravgsh16/message-server/proto"
+)
+
+// Queue arguments given in queue declare
+const (
+	ArgDeadLetterExchange   = "x-dead-letter-exchange"
+	ArgDeadLetterRoutingKey = "x-dead-letter-routing-key"
+	ArgMessageTTL           = "x-message-ttl"
+	ArgMaxLength            = "x-max-length"
+	ArgMaxLengthBytes       = "x-max-length-bytes"
+	ArgOverflow             = "x-overflow"
+	ArgMaxPriority          = "x-max-priority"
+)
+
+// Overflow policies of a queue at its length limits
+const (
+	// OverflowDropHead drops, or dead letters, the oldest messages
+	OverflowDropHead = "drop-head"
+	// OverflowRejectPublish rejects newly published messages
+	OverflowRejectPublish = "reject-publish"
+	// OverflowRejectPublishDLX rejects and dead letters newly published messages
+	OverflowRejectPublishDLX = "reject-publish-dlx"
+)
+
+// SetArguments validates the queue declare arguments and applies them to the queue
+func (q *Queue) SetArguments(args proto.Table) error {
+	dlx, err := stringArg(args, ArgDeadLetterExchange)
+	if err != nil {
+		return err
+	}
+	dlk, err := stringArg(args, ArgDeadLetterRoutingKey)
+	if err != nil {
+		return err
+	}
+	if len(dlk) > 0 && len(dlx) == 0 {
+		return fmt.Errorf("%s requires %s", ArgDeadLetterRoutingKey, ArgDeadLetterExchange)
+	}
+	ttl, hasTTL, err := intArg(args, ArgMessageTTL)
+	if err != nil {
+		return err
+	}
+	if hasTTL && ttl < 0 {
+		return fmt.Errorf("invalid %s: must not be negative", ArgMessageTTL)
+	}
+	maxLen, hasMaxLen, err := intArg(args, ArgMaxLength)
+	if err != nil {
+		return err
+	}
+	if hasMaxLen && maxLen < 0 {
+		return fmt.Errorf("invalid %s: must not be negative", ArgMaxLength)
+	}
+	maxBytes, hasMaxBytes, err := intArg(args, ArgMaxLengthBytes)
+	if err != nil {
+		return err
+	}
+	if hasMaxBytes && maxBytes < 0 {
+		return fmt.Errorf("invalid %s: must not be negative", ArgMaxLengthBytes)
+	}
+	overflow, err := stringArg(args, ArgOverflow)
+	if err != nil {
+		return err
+	}
+	switch overflow {
+	case "":
+		overflow = OverflowDropHead
+	case OverflowDropHead, OverflowRejectPublish, OverflowRejectPublishDLX:
+	default:
+		return fmt.Errorf("invalid %s: unknown policy %s", ArgOverflow, overflow)
+	}
+	maxPriority, hasMaxPriority, err := intArg(args, ArgMaxPriority)
+	if err != nil {
+		return err
+	}
+	if hasMaxPriority && (maxPriority < 1 || maxPriority > 255) {
+		return fmt.Errorf("invalid %s: must be between 1 and 255", ArgMaxPriority)
+	}
+
+	q.Args = args
+	q.DeadLetterExchange = dlx
+	q.DeadLetterRoutingKey = dlk
+	q.MessageTTL = -1
+	if hasTTL {
+		q.MessageTTL = time.Duration(ttl) * time.Millisecond
+	}
+	q.MaxLength = -1
+	if hasMaxLen {
+		q.MaxLength = maxLen
+	}
+	q.MaxLengthBytes = -1
+	if hasMaxBytes {
+		q.MaxLengthBytes = maxBytes
+	}
+	q.Overflow = overflow
+	// Arguments are set before any message is added to the queue
+	if hasMaxPriority {
+		q.list = newPriorityList(uint8(maxPriority))
+	}
+	return nil
+}
+
+// EqualArguments returns true if the arguments are the ones the queue was declared with
+func (q *Queue) EqualArguments(args proto.Table) bool {
+	return proto.EqualTables(q.Args, args)
+}
+
+func stringArg(args proto.Table, name string) (string, error) {
+	v, found := args[name]
+	if !found {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid %s: expected string, got %T", name, v)
+	}
+	return s, nil
+}
+
+func intArg(args proto.Table, name string) (int64, bool, error) {
+	v, found := args[name]
+	if !found {
+		return 0, false, nil
+	}
+	i, ok := proto.IntValue(v)
+	if !ok {
+		return 0, false, fmt.Errorf("invalid %s: expected integer, got %T", name, v)
+	}
+	return i, true, nil
+}
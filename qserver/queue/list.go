@@ -4,10 +4,22 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+
+	"github.com/sauravgsh16/message-server/proto"
 )
 
 type qData interface{}
 
+// messageList holds the messages of a queue in delivery order
+type messageList interface {
+	Append(d qData)
+	Prepend(d qData)
+	Remove()
+	Front() qData
+	Len() int
+	removeRef() []qData
+}
+
 type msg struct {
 	next  *msg
 	value qData
@@ -28,10 +40,18 @@ func (l *List) Len() int {
 // NewList points to pointer to a new list
 func newlist() *List { return &List{} }
 
-func (l *List) removeRef() *List {
-	l.Root = &msg{}
+// removeRef empties the list, returning the removed values
+func (l *List) removeRef() []qData {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	removed := make([]qData, 0, l.len)
+	for cur := l.Root; cur != nil; cur = cur.next {
+		removed = append(removed, cur.value)
+	}
+	l.Root = nil
 	l.len = 0
-	return l
+	return removed
 }
 
 func (l *List) findLast() *msg {
@@ -52,6 +72,10 @@ func (l *List) append(d qData) {
 	last.next = n
 }
 
+func (l *List) prepend(d qData) {
+	l.Root = &msg{next: l.Root, value: d}
+}
+
 func (l *List) remove() error {
 	if l.Root == nil {
 		return errors.New("Cannot remove from empty list")
@@ -72,6 +96,15 @@ func (l *List) Append(d qData) {
 	l.len++
 }
 
+// Prepend to front of list
+func (l *List) Prepend(d qData) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.prepend(d)
+	l.len++
+}
+
 // Remove one msg
 func (l *List) Remove() {
 	l.mux.Lock()
@@ -100,3 +133,101 @@ func (l *List) String() string {
 	}
 	return fmt.Sprintf("%s, of lenght %d", data, l.len)
 }
+
+// priorityList holds a FIFO list for each priority level.
+// Messages of higher priority levels are delivered first.
+type priorityList struct {
+	levels []*List
+	len    int
+	mux    sync.Mutex
+}
+
+// newPriorityList returns a list with priority levels from zero to maxPriority
+func newPriorityList(maxPriority uint8) *priorityList {
+	levels := make([]*List, int(maxPriority)+1)
+	for i := range levels {
+		levels[i] = newlist()
+	}
+	return &priorityList{levels: levels}
+}
+
+// level returns the list for the priority of the queue message.
+// Priorities above the max priority are treated as the max priority.
+func (pl *priorityList) level(d qData) *List {
+	p := int(d.(*proto.QueueMessage).Priority)
+	if p >= len(pl.levels) {
+		p = len(pl.levels) - 1
+	}
+	return pl.levels[p]
+}
+
+// head returns the highest priority list holding messages
+func (pl *priorityList) head() *List {
+	for i := len(pl.levels) - 1; i >= 0; i-- {
+		if pl.levels[i].Len() > 0 {
+			return pl.levels[i]
+		}
+	}
+	return nil
+}
+
+// Len of list
+func (pl *priorityList) Len() int {
+	return pl.len
+}
+
+// Append to end of the priority level of the message
+func (pl *priorityList) Append(d qData) {
+	pl.mux.Lock()
+	defer pl.mux.Unlock()
+
+	pl.level(d).Append(d)
+	pl.len++
+}
+
+// Prepend to front of the priority level of the message
+func (pl *priorityList) Prepend(d qData) {
+	pl.mux.Lock()
+	defer pl.mux.Unlock()
+
+	pl.level(d).Prepend(d)
+	pl.len++
+}
+
+// Remove the front msg of the highest priority level
+func (pl *priorityList) Remove() {
+	pl.mux.Lock()
+	defer pl.mux.Unlock()
+
+	l := pl.head()
+	if l == nil {
+		panic("Cannot remove from empty list")
+	}
+	l.Remove()
+	pl.len--
+}
+
+// Front returns front element of the highest priority level
+func (pl *priorityList) Front() qData {
+	pl.mux.Lock()
+	defer pl.mux.Unlock()
+
+	l := pl.head()
+	if l == nil {
+		return nil
+	}
+	return l.Front()
+}
+
+// removeRef empties all the priority levels, returning the removed values
+func (pl *priorityList) removeRef() []qData {
+	pl.mux.Lock()
+	defer pl.mux.Unlock()
+
+	removed := make([]qData, 0, pl.len)
+	for i := len(pl.levels) - 1; i >= 0; i-- {
+		removed = append(removed, pl.levels[i].removeRef()...)
+	}
+	pl.len = 0
+	return removed
+}
@@ -0,0 +1,201 @@
+package queue
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sauravgsh16/message-server/proto"
+)
+
+// qm returns a queue message with the id and priority
+func qm(id int64, priority uint8) *proto.QueueMessage {
+	return &proto.QueueMessage{ID: id, Priority: priority}
+}
+
+// drain removes all messages from the list, returning their ids in delivery order
+func drain(t *testing.T, l messageList) []int64 {
+	ids := make([]int64, 0)
+	for l.Len() > 0 {
+		front := l.Front()
+		if front == nil {
+			t.Fatalf("Front() = nil with %d messages in the list", l.Len())
+		}
+		ids = append(ids, front.(*proto.QueueMessage).ID)
+		l.Remove()
+	}
+	if front := l.Front(); front != nil {
+		t.Errorf("Front() = %v on an empty list", front)
+	}
+	return ids
+}
+
+func TestPriorityListOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxPriority uint8
+		messages    []*proto.QueueMessage
+		want        []int64
+	}{
+		{
+			"single level is FIFO",
+			0,
+			[]*proto.QueueMessage{qm(1, 0), qm(2, 0), qm(3, 0)},
+			[]int64{1, 2, 3},
+		},
+		{
+			"FIFO within a level",
+			5,
+			[]*proto.QueueMessage{qm(1, 3), qm(2, 3), qm(3, 3)},
+			[]int64{1, 2, 3},
+		},
+		{
+			"higher priority first",
+			5,
+			[]*proto.QueueMessage{qm(1, 1), qm(2, 5), qm(3, 3)},
+			[]int64{2, 3, 1},
+		},
+		{
+			"FIFO within and across levels",
+			2,
+			[]*proto.QueueMessage{qm(1, 0), qm(2, 2), qm(3, 1), qm(4, 2), qm(5, 0), qm(6, 1)},
+			[]int64{2, 4, 3, 6, 1, 5},
+		},
+		{
+			"above max priority is treated as max priority",
+			2,
+			[]*proto.QueueMessage{qm(1, 2), qm(2, 9), qm(3, 255), qm(4, 1)},
+			[]int64{1, 2, 3, 4},
+		},
+		{
+			"max priority zero ignores priorities",
+			0,
+			[]*proto.QueueMessage{qm(1, 0), qm(2, 7), qm(3, 1)},
+			[]int64{1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pl := newPriorityList(tt.maxPriority)
+			for _, m := range tt.messages {
+				pl.Append(m)
+			}
+			if pl.Len() != len(tt.messages) {
+				t.Fatalf("Len() = %d, want %d", pl.Len(), len(tt.messages))
+			}
+			if got := drain(t, pl); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("delivered %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriorityListInterleavedRemove(t *testing.T) {
+	pl := newPriorityList(3)
+	pl.Append(qm(1, 1))
+	pl.Append(qm(2, 1))
+
+	if id := pl.Front().(*proto.QueueMessage).ID; id != 1 {
+		t.Fatalf("Front() = %d, want 1", id)
+	}
+	pl.Remove()
+
+	// A higher priority message arriving later overtakes the waiting one
+	pl.Append(qm(3, 3))
+	if got := drain(t, pl); !reflect.DeepEqual(got, []int64{3, 2}) {
+		t.Errorf("delivered %v, want [3 2]", got)
+	}
+}
+
+func TestPriorityListPrepend(t *testing.T) {
+	tests := []struct {
+		name     string
+		appended []*proto.QueueMessage
+		requeued []*proto.QueueMessage
+		want     []int64
+	}{
+		{
+			"requeued goes to the head of its level",
+			[]*proto.QueueMessage{qm(2, 1), qm(3, 1)},
+			[]*proto.QueueMessage{qm(1, 1)},
+			[]int64{1, 2, 3},
+		},
+		{
+			"requeued stays behind higher levels",
+			[]*proto.QueueMessage{qm(2, 3), qm(3, 1)},
+			[]*proto.QueueMessage{qm(1, 1)},
+			[]int64{2, 1, 3},
+		},
+		{
+			"requeued goes ahead of lower levels",
+			[]*proto.QueueMessage{qm(2, 0), qm(3, 0)},
+			[]*proto.QueueMessage{qm(1, 2)},
+			[]int64{1, 2, 3},
+		},
+		{
+			// Unacked messages are requeued in reverse, to keep their order
+			"requeued in reverse keep their order",
+			[]*proto.QueueMessage{qm(4, 1)},
+			[]*proto.QueueMessage{qm(3, 1), qm(2, 1), qm(1, 1)},
+			[]int64{1, 2, 3, 4},
+		},
+		{
+			"requeued to an empty list",
+			nil,
+			[]*proto.QueueMessage{qm(2, 0), qm(1, 2)},
+			[]int64{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pl := newPriorityList(3)
+			for _, m := range tt.appended {
+				pl.Append(m)
+			}
+			for _, m := range tt.requeued {
+				pl.Prepend(m)
+			}
+			if want := len(tt.appended) + len(tt.requeued); pl.Len() != want {
+				t.Fatalf("Len() = %d, want %d", pl.Len(), want)
+			}
+			if got := drain(t, pl); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("delivered %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriorityListRemoveRef(t *testing.T) {
+	pl := newPriorityList(2)
+	for _, m := range []*proto.QueueMessage{qm(1, 0), qm(2, 2), qm(3, 1), qm(4, 2)} {
+		pl.Append(m)
+	}
+
+	removed := pl.removeRef()
+	ids := make([]int64, 0, len(removed))
+	for _, d := range removed {
+		ids = append(ids, d.(*proto.QueueMessage).ID)
+	}
+	if want := []int64{2, 4, 3, 1}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("removed %v, want %v", ids, want)
+	}
+	if pl.Len() != 0 || pl.Front() != nil {
+		t.Errorf("list holds %d messages after removeRef, want none", pl.Len())
+	}
+
+	// The list is usable again once emptied
+	pl.Append(qm(5, 1))
+	if got := drain(t, pl); !reflect.DeepEqual(got, []int64{5}) {
+		t.Errorf("delivered %v, want [5]", got)
+	}
+}
+
+func TestPriorityListRemoveEmptyPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Remove on an empty list did not panic")
+		}
+	}()
+	newPriorityList(1).Remove()
+}
@@ -4,38 +4,80 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/sauravgsh16/message-server/proto"
 	"github.com/sauravgsh16/message-server/qserver/consumer"
 	"github.com/sauravgsh16/message-server/qserver/store"
 )
 
+// Reasons for dead lettering a message
+const (
+	DeadLetterRejected = "rejected"
+	DeadLetterExpired  = "expired"
+	DeadLetterMaxLen   = "maxlen"
+)
+
+// Errors returned when a queue does not take a message
+var (
+	ErrQueueClosed = errors.New("queue closed")
+	ErrQueueFull   = errors.New("queue length limit reached")
+)
+
+// DeadLetterFunc dead letters a message dropped from the queue for the reason.
+// The queue still holds its reference to the message while it is called.
+type DeadLetterFunc func(q *Queue, qm *proto.QueueMessage, reason string)
+
 type Queue struct {
-	Name               string
-	list               *List
-	Closed             bool
-	mux                sync.Mutex
-	consumers          []*consumer.Consumer
-	consumerMux        sync.RWMutex
-	ConnId             int64
-	deleteChan         chan *Queue
-	readyChan          chan bool
-	currentConsumerIdx int
-	msgStore           *store.MsgStore
-}
-
-func NewQueue(name string, connId int64, deleteChan chan *Queue, msgStore *store.MsgStore) *Queue {
+	Name                 string
+	list                 messageList
+	Closed               bool
+	mux                  sync.Mutex
+	consumers            []*consumer.Consumer
+	consumerMux          sync.RWMutex
+	ConnId               int64
+	Durable              bool
+	Exclusive            bool
+	AutoDelete           bool
+	Args                 proto.Table
+	DeadLetterExchange   string
+	DeadLetterRoutingKey string
+	MessageTTL           time.Duration
+	MaxLength            int64
+	MaxLengthBytes       int64
+	Overflow             string
+	size                 uint64
+	deleteChan           chan *Queue
+	deadLetter           DeadLetterFunc
+	expiryTimer          *time.Timer
+	readyChan            chan bool
+	currentConsumerIdx   int
+	msgStore             *store.MsgStore
+}
+
+func NewQueue(name string, connId int64, deleteChan chan *Queue, deadLetter DeadLetterFunc, msgStore *store.MsgStore) *Queue {
 	return &Queue{
-		Name:       name,
-		list:       newlist(),
-		consumers:  make([]*consumer.Consumer, 0, 1),
-		deleteChan: deleteChan,
-		readyChan:  make(chan bool, 1),
-		msgStore:   msgStore,
-		ConnId:     connId,
+		Name:           name,
+		list:           newlist(),
+		consumers:      make([]*consumer.Consumer, 0, 1),
+		deleteChan:     deleteChan,
+		deadLetter:     deadLetter,
+		readyChan:      make(chan bool, 1),
+		msgStore:       msgStore,
+		ConnId:         connId,
+		MessageTTL:     -1,
+		MaxLength:      -1,
+		MaxLengthBytes: -1,
+		Overflow:       OverflowDropHead,
 	}
 }
 
+// Persistent returns true if the queue and its messages outlive a server restart.
+// Exclusive queues are deleted along with their connection, hence never outlive it.
+func (q *Queue) Persistent() bool {
+	return q.Durable && !q.Exclusive
+}
+
 func (q *Queue) Start() {
 	go func() {
 		select {
@@ -43,7 +85,7 @@ func (q *Queue) Start() {
 		default:
 		}
 		for range q.readyChan {
-			if q.Closed {
+			if q.isClosed() {
 				fmt.Printf("Queue Closed: %s\n", q.Name)
 				break
 			}
@@ -60,20 +102,85 @@ func (q *Queue) Len() uint32 {
 	return uint32(l)
 }
 
+// isClosed returns true once the queue is closed
+func (q *Queue) isClosed() bool {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return q.Closed
+}
+
 func (q *Queue) Close() {
 	q.mux.Lock()
 	defer q.mux.Unlock()
 	q.Closed = true
+	q.scheduleExpiry()
+}
+
+// Add appends the message to the queue. A queue at its length limits either
+// rejects the message with ErrQueueFull, or drops messages from its head to make room.
+func (q *Queue) Add(qm *proto.QueueMessage) error {
+	q.mux.Lock()
+
+	if q.Closed {
+		q.mux.Unlock()
+		return ErrQueueClosed
+	}
+	if q.Overflow != OverflowDropHead && q.exceedsLimits(1, uint64(qm.MsgSize)) {
+		q.mux.Unlock()
+		return ErrQueueFull
+	}
+
+	q.list.Append(qm)
+	q.size += uint64(qm.MsgSize)
+
+	dropped := make([]*proto.QueueMessage, 0)
+	for q.list.Len() > 0 && q.exceedsLimits(0, 0) {
+		dropped = append(dropped, q.pop())
+	}
+	if q.list.Len() == 1 || len(dropped) > 0 {
+		q.scheduleExpiry()
+	}
+
+	select {
+	case q.readyChan <- true:
+	default:
+	}
+	q.mux.Unlock()
+
+	for _, d := range dropped {
+		q.drop(d, DeadLetterMaxLen)
+	}
+	return nil
 }
 
-func (q *Queue) Add(qm *proto.QueueMessage) bool {
+// exceedsLimits returns true if the queue would be over its length limits
+// with count more messages of total size more bytes. Must hold q.mux.
+func (q *Queue) exceedsLimits(count int, size uint64) bool {
+	if q.MaxLength >= 0 && int64(q.list.Len()+count) > q.MaxLength {
+		return true
+	}
+	return q.MaxLengthBytes >= 0 && q.size+size > uint64(q.MaxLengthBytes)
+}
+
+// pop removes the message at the head of the queue. Must hold q.mux.
+func (q *Queue) pop() *proto.QueueMessage {
+	qm := q.list.Front().(*proto.QueueMessage)
+	q.list.Remove()
+	q.size -= uint64(qm.MsgSize)
+	return qm
+}
+
+// Requeue puts back a previously delivered message at the head of the queue
+func (q *Queue) Requeue(qm *proto.QueueMessage) bool {
 	q.mux.Lock()
 	defer q.mux.Unlock()
 
 	if q.Closed {
 		return false
 	}
-	q.list.Append(qm)
+	q.list.Prepend(qm)
+	q.size += uint64(qm.MsgSize)
+	q.scheduleExpiry()
 
 	select {
 	case q.readyChan <- true:
@@ -149,6 +256,16 @@ func (q *Queue) AddConsumer(c *consumer.Consumer) (uint16, error) {
 	return 0, nil // Check: if it really needs to return the number of consumers ?
 }
 
+// RemoveConsumer removes the consumer from the queue.
+// Auto delete queues are deleted once their last consumer is removed.
+func (q *Queue) RemoveConsumer(consumerTag string) {
+	if q.removeConsumers(consumerTag) == 0 && q.AutoDelete && !q.isClosed() {
+		go func() {
+			q.deleteChan <- q
+		}()
+	}
+}
+
 func (q *Queue) cancelConsumers() {
 	q.consumerMux.Lock()
 	defer q.consumerMux.Unlock()
@@ -160,30 +277,57 @@ func (q *Queue) cancelConsumers() {
 	q.consumers = make([]*consumer.Consumer, 0, 1)
 }
 
-func (q *Queue) removeConsumers(consumerTag string) {
+// removeConsumers removes consumers with the consumer tag
+// and returns the number of remaining consumers
+func (q *Queue) removeConsumers(consumerTag string) int {
 	q.consumerMux.Lock()
 	defer q.consumerMux.Unlock()
 
 	// Remove consumers based on consumerTag
-	for i, c := range q.consumers {
-		if c.ConsumerTag == consumerTag {
-			q.consumers = append(q.consumers[:i], q.consumers[i+1:]...)
+	consumers := make([]*consumer.Consumer, 0, len(q.consumers))
+	for _, c := range q.consumers {
+		if c.ConsumerTag != consumerTag {
+			consumers = append(consumers, c)
 		}
 	}
+	q.consumers = consumers
+
 	if len(q.consumers) == 0 {
 		q.currentConsumerIdx = 0
 	} else {
 		q.currentConsumerIdx = q.currentConsumerIdx % len(q.consumers)
 	}
+	return len(q.consumers)
+}
+
+// Purge removes all the messages waiting in the queue, and returns
+// the count of messages removed. Unacknowledged messages are not affected.
+func (q *Queue) Purge() (uint32, error) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if q.Closed {
+		return 0, ErrQueueClosed
+	}
+	return q.purgeQueueData(), nil
 }
 
+// purgeQueueData empties the queue, and releases the references the
+// message store holds for the queue's messages
 func (q *Queue) purgeQueueData() uint32 {
-	length := q.list.Len()
-	q.list.removeRef()
-	return uint32(length)
+	removed := q.list.removeRef()
+	for _, d := range removed {
+		q.msgStore.RemoveRef(d.(*proto.QueueMessage), q.Name, nil)
+	}
+	q.size = 0
+	q.scheduleExpiry()
+	return uint32(len(removed))
 }
 
 func (q *Queue) GetOne(mrh ...proto.MessageResourceHolder) (*proto.QueueMessage, *proto.Message) {
+	// Expired messages are never delivered
+	q.expireMessages()
+
 	q.mux.Lock()
 	defer q.mux.Unlock()
 
@@ -199,6 +343,77 @@ func (q *Queue) GetOne(mrh ...proto.MessageResourceHolder) (*proto.QueueMessage,
 	if !acquired {
 		return nil, nil
 	}
-	q.list.Remove()
+	q.pop()
+	q.scheduleExpiry()
 	return qm, msg
 }
+
+// expiresAt returns when the message expires in the queue, in unix nanoseconds.
+// The message expires with the earlier of its own expiration and the queue message TTL.
+// Zero means the message never expires.
+func (q *Queue) expiresAt(qm *proto.QueueMessage) int64 {
+	expiresAt := qm.ExpiresAt
+	if q.MessageTTL >= 0 {
+		queueExpiresAt := qm.EnqueuedAt + int64(q.MessageTTL)
+		if expiresAt == 0 || queueExpiresAt < expiresAt {
+			expiresAt = queueExpiresAt
+		}
+	}
+	return expiresAt
+}
+
+// scheduleExpiry arms the expiry timer for the message at the head of the queue.
+// Only the head is checked, messages behind it expire once they reach the head.
+func (q *Queue) scheduleExpiry() {
+	if q.expiryTimer != nil {
+		q.expiryTimer.Stop()
+		q.expiryTimer = nil
+	}
+	if q.Closed || q.list.Len() == 0 {
+		return
+	}
+
+	expiresAt := q.expiresAt(q.list.Front().(*proto.QueueMessage))
+	if expiresAt == 0 {
+		return
+	}
+	q.expiryTimer = time.AfterFunc(time.Until(time.Unix(0, expiresAt)), q.expireMessages)
+}
+
+// expireMessages drops the expired messages at the head of the queue
+func (q *Queue) expireMessages() {
+	for _, qm := range q.takeExpired() {
+		q.drop(qm, DeadLetterExpired)
+	}
+}
+
+func (q *Queue) takeExpired() []*proto.QueueMessage {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	expired := make([]*proto.QueueMessage, 0)
+	if q.Closed {
+		return expired
+	}
+
+	now := time.Now().UnixNano()
+	for q.list.Len() > 0 {
+		qm := q.list.Front().(*proto.QueueMessage)
+		if expiresAt := q.expiresAt(qm); expiresAt == 0 || expiresAt > now {
+			break
+		}
+		expired = append(expired, q.pop())
+	}
+	q.scheduleExpiry()
+	return expired
+}
+
+// drop removes the reference of the queue to a message taken off the queue,
+// dead lettering the message first. It must not be called holding the queue lock,
+// as the dead letter exchange might route the message back to the queue.
+func (q *Queue) drop(qm *proto.QueueMessage, reason string) {
+	if q.deadLetter != nil {
+		q.deadLetter(q, qm, reason)
+	}
+	q.msgStore.RemoveRef(qm, q.Name, nil)
+}
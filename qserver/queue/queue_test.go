@@ -0,0 +1,272 @@
+package queue
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sauravgsh16/message-server/proto"
+	"github.com/sauravgsh16/message-server/qserver/store"
+)
+
+// dropped records the messages dropped from a queue and why
+type dropped struct {
+	ids     []int64
+	reasons []string
+}
+
+func (d *dropped) deadLetter(q *Queue, qm *proto.QueueMessage, reason string) {
+	d.ids = append(d.ids, qm.ID)
+	d.reasons = append(d.reasons, reason)
+}
+
+// newStoreQueue returns a queue on an empty message store, which records the
+// messages it drops, and a function which removes the store
+func newStoreQueue(t *testing.T) (*Queue, *dropped, func()) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgStore, err := store.New(filepath.Join(dir, "messages.db"), func(string) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &dropped{}
+	q := NewQueue("q", -1, nil, d.deadLetter, msgStore)
+	return q, d, func() {
+		q.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// storeMessage adds a message with a body of size bytes to the store of the queue
+func storeMessage(t *testing.T, q *Queue, size int) *proto.QueueMessage {
+	msg := proto.NewMessage(&proto.BasicPublish{Exchange: "", RoutingKey: q.Name})
+	msg.Payload = make([]byte, size)
+	qms, err := q.msgStore.AddMessage(msg, []string{q.Name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return qms[q.Name][0]
+}
+
+// takeAll empties the queue, returning the ids of its messages from the head
+func takeAll(t *testing.T, q *Queue) []int64 {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return drain(t, q.list)
+}
+
+func TestAddDropHead(t *testing.T) {
+	q, d, cleanup := newStoreQueue(t)
+	defer cleanup()
+	q.MaxLength = 2
+
+	added := make([]int64, 0)
+	for i := 0; i < 4; i++ {
+		qm := storeMessage(t, q, 1)
+		if err := q.Add(qm); err != nil {
+			t.Fatalf("Add() = %v, want nil", err)
+		}
+		added = append(added, qm.ID)
+	}
+
+	if !reflect.DeepEqual(d.ids, added[:2]) {
+		t.Errorf("dropped %v, want %v", d.ids, added[:2])
+	}
+	if want := []string{DeadLetterMaxLen, DeadLetterMaxLen}; !reflect.DeepEqual(d.reasons, want) {
+		t.Errorf("dropped for %v, want %v", d.reasons, want)
+	}
+	for _, id := range d.ids {
+		if _, found := q.msgStore.GetMsg(id); found {
+			t.Errorf("message %d still stored after it was dropped", id)
+		}
+	}
+	if got := takeAll(t, q); !reflect.DeepEqual(got, added[2:]) {
+		t.Errorf("queue holds %v, want %v", got, added[2:])
+	}
+}
+
+func TestAddDropHeadBytes(t *testing.T) {
+	q, d, cleanup := newStoreQueue(t)
+	defer cleanup()
+	q.MaxLengthBytes = 10
+
+	first, second, third := storeMessage(t, q, 4), storeMessage(t, q, 4), storeMessage(t, q, 6)
+	for _, qm := range []*proto.QueueMessage{first, second, third} {
+		if err := q.Add(qm); err != nil {
+			t.Fatalf("Add() = %v, want nil", err)
+		}
+	}
+
+	// Only as many messages as needed are dropped to fit the third
+	if want := []int64{first.ID}; !reflect.DeepEqual(d.ids, want) {
+		t.Errorf("dropped %v, want %v", d.ids, want)
+	}
+	if q.size != 10 {
+		t.Errorf("queue size = %d, want 10", q.size)
+	}
+
+	// A message larger than the limit does not stay in the queue
+	large := storeMessage(t, q, 11)
+	if err := q.Add(large); err != nil {
+		t.Fatalf("Add() = %v, want nil", err)
+	}
+	if want := []int64{first.ID, second.ID, third.ID, large.ID}; !reflect.DeepEqual(d.ids, want) {
+		t.Errorf("dropped %v, want %v", d.ids, want)
+	}
+	if q.Len() != 0 || q.size != 0 {
+		t.Errorf("queue holds %d messages of %d bytes, want none", q.Len(), q.size)
+	}
+}
+
+func TestAddRejectPublish(t *testing.T) {
+	for _, overflow := range []string{OverflowRejectPublish, OverflowRejectPublishDLX} {
+		t.Run(overflow, func(t *testing.T) {
+			tests := []struct {
+				name      string
+				maxLength int64
+				maxBytes  int64
+				sizes     []int
+			}{
+				{"max length", 2, -1, []int{1, 1, 1}},
+				{"max length bytes", -1, 5, []int{2, 3, 1}},
+				{"max length zero", 0, -1, []int{1}},
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					d := &dropped{}
+					q := NewQueue("q", -1, nil, d.deadLetter, nil)
+					defer q.Close()
+					q.Overflow = overflow
+					q.MaxLength = tt.maxLength
+					q.MaxLengthBytes = tt.maxBytes
+
+					// Every message but the last fits in the queue
+					last := len(tt.sizes) - 1
+					for i, size := range tt.sizes {
+						err := q.Add(&proto.QueueMessage{ID: int64(i), MsgSize: uint32(size)})
+						if i < last && err != nil {
+							t.Fatalf("Add() of message %d = %v, want nil", i, err)
+						}
+						if i == last && err != ErrQueueFull {
+							t.Fatalf("Add() of message %d = %v, want %v", i, err, ErrQueueFull)
+						}
+					}
+
+					// The queue drops nothing, the server decides what happens to rejected messages
+					if len(d.ids) != 0 {
+						t.Errorf("dropped %v, want none", d.ids)
+					}
+					if q.Len() != uint32(last) {
+						t.Errorf("queue holds %d messages, want %d", q.Len(), last)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestAddClosed(t *testing.T) {
+	q := NewQueue("q", -1, nil, nil, nil)
+	q.Close()
+
+	if err := q.Add(qm(1, 0)); err != ErrQueueClosed {
+		t.Errorf("Add() to a closed queue = %v, want %v", err, ErrQueueClosed)
+	}
+}
+
+// fill appends the messages to the queue, without arming the expiry timer
+func fill(q *Queue, qms ...*proto.QueueMessage) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	for _, qm := range qms {
+		q.list.Append(qm)
+	}
+}
+
+func TestExpiresAt(t *testing.T) {
+	const enqueuedAt = int64(1000)
+
+	tests := []struct {
+		name       string
+		ttl        time.Duration
+		expiresAt  int64
+		wantExpiry int64
+	}{
+		{"no expiration", -1, 0, 0},
+		{"message expiration", -1, 5000, 5000},
+		{"queue ttl", 3000, 0, enqueuedAt + 3000},
+		{"queue ttl zero", 0, 0, enqueuedAt},
+		{"queue ttl first", 3000, 5000, enqueuedAt + 3000},
+		{"message expiration first", 3000, 2000, 2000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQueue("q", -1, nil, nil, nil)
+			q.MessageTTL = tt.ttl
+
+			got := q.expiresAt(&proto.QueueMessage{EnqueuedAt: enqueuedAt, ExpiresAt: tt.expiresAt})
+			if got != tt.wantExpiry {
+				t.Errorf("expiresAt() = %d, want %d", got, tt.wantExpiry)
+			}
+		})
+	}
+}
+
+func TestTakeExpired(t *testing.T) {
+	q := NewQueue("q", -1, nil, nil, nil)
+	defer q.Close()
+
+	past := time.Now().Add(-time.Minute).UnixNano()
+	future := time.Now().Add(time.Hour).UnixNano()
+	// Expired messages behind one which is not expired wait until they reach the head
+	for i, expiresAt := range []int64{past, past, future, past, 0} {
+		fill(q, &proto.QueueMessage{ID: int64(i), ExpiresAt: expiresAt})
+	}
+
+	expired := make([]int64, 0)
+	for _, qm := range q.takeExpired() {
+		expired = append(expired, qm.ID)
+	}
+	if want := []int64{0, 1}; !reflect.DeepEqual(expired, want) {
+		t.Errorf("takeExpired() = %v, want %v", expired, want)
+	}
+	if q.expiryTimer == nil {
+		t.Error("no expiry armed for the new head of the queue")
+	}
+	if got, want := takeAll(t, q), []int64{2, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("queue holds %v, want %v", got, want)
+	}
+}
+
+func TestTakeExpiredQueueTTL(t *testing.T) {
+	q := NewQueue("q", -1, nil, nil, nil)
+	defer q.Close()
+	q.MessageTTL = time.Minute
+
+	now := time.Now()
+	for i, enqueuedAt := range []time.Time{now.Add(-2 * time.Minute), now.Add(-time.Minute), now} {
+		fill(q, &proto.QueueMessage{ID: int64(i), EnqueuedAt: enqueuedAt.UnixNano()})
+	}
+
+	if got := q.takeExpired(); len(got) != 2 {
+		t.Fatalf("takeExpired() took %d messages, want 2", len(got))
+	}
+	if q.Len() != 1 {
+		t.Errorf("queue holds %d messages, want 1", q.Len())
+	}
+
+	// Closed queues expire nothing
+	q.MessageTTL = 0
+	q.Close()
+	if got := q.takeExpired(); len(got) != 0 {
+		t.Errorf("takeExpired() on a closed queue took %d messages", len(got))
+	}
+}
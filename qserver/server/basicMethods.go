@@ -1,8 +1,12 @@
 package server
 
 import (
+	"fmt"
+
 	"github.com/sauravgsh16/message-server/allocate"
 	"github.com/sauravgsh16/message-server/proto"
+	"github.com/sauravgsh16/message-server/qserver/consumer"
+	"github.com/sauravgsh16/message-server/qserver/queue"
 )
 
 func (ch *Channel) basicRoute(msgf proto.MessageFrame) *proto.Error {
@@ -18,13 +22,17 @@ func (ch *Channel) basicRoute(msgf proto.MessageFrame) *proto.Error {
 		return ch.basicPublish(m)
 
 	case *proto.BasicAck:
-		// TODO: To implement
 		return ch.basicAck(m)
 
 	case *proto.BasicNack:
-		// TODO: To implement
 		return ch.basicNack(m)
 
+	case *proto.BasicGet:
+		return ch.basicGet(m)
+
+	case *proto.BasicQos:
+		return ch.basicQos(m)
+
 	default:
 		clsID, mtdID := msgf.Identifier()
 		return proto.NewHardError(540, "unable to route method frame", clsID, mtdID)
@@ -47,6 +55,14 @@ func (ch *Channel) basicConsume(m *proto.BasicConsume) *proto.Error {
 		return proto.NewSoftError(404, "Queue not found", clsID, mtdID)
 	}
 
+	if q.ConnId != -1 && q.ConnId != ch.conn.id {
+		return proto.NewSoftError(405, "Queue is locked by another connection", clsID, mtdID)
+	}
+
+	if err := consumer.CheckArguments(m.Arguments); err != nil {
+		return proto.NewSoftError(406, err.Error(), clsID, mtdID)
+	}
+
 	if len(m.ConsumerTag) == 0 {
 		m.ConsumerTag = allocate.RandomID()
 	}
@@ -85,9 +101,119 @@ func (ch *Channel) basicPublish(m *proto.BasicPublish) *proto.Error {
 }
 
 func (ch *Channel) basicAck(m *proto.BasicAck) *proto.Error {
+	clsID, mtdID := m.Identifier()
+
+	ums, found := ch.takeUnacked(m.DeliveryTag, m.Multiple)
+	if !found {
+		return proto.NewSoftError(406, fmt.Sprintf("Unknown delivery tag: %d", m.DeliveryTag), clsID, mtdID)
+	}
+
+	// Every message has been taken off the unacked map, so all are
+	// released even if one fails, and the first error is returned
+	var err error
+	for _, um := range ums {
+		if rErr := ch.releaseUnacked(um); rErr != nil && err == nil {
+			err = rErr
+		}
+	}
+
+	// Resources have been freed, consumers can start work again
+	ch.pingConsumers()
+	if err != nil {
+		return proto.NewSoftError(500, err.Error(), clsID, mtdID)
+	}
 	return nil
 }
 
 func (ch *Channel) basicNack(m *proto.BasicNack) *proto.Error {
+	clsID, mtdID := m.Identifier()
+
+	ums, found := ch.takeUnacked(m.DeliveryTag, m.Multiple)
+	if !found {
+		return proto.NewSoftError(406, fmt.Sprintf("Unknown delivery tag: %d", m.DeliveryTag), clsID, mtdID)
+	}
+
+	// Every message has been taken off the unacked map, so all are
+	// requeued or released even if one fails, and the first error is returned
+	var err error
+	if m.Requeue {
+		// Requeue in reverse so that messages retain their original order
+		for i := len(ums) - 1; i >= 0; i-- {
+			if rErr := ch.requeueUnacked(ums[i]); rErr != nil && err == nil {
+				err = rErr
+			}
+		}
+	} else {
+		// Rejected messages are dead lettered, if the queue has
+		// a dead letter exchange, otherwise they are dropped
+		for _, um := range ums {
+			if q, found := ch.server.getQueue(um.queueName); found {
+				ch.server.deadLetter(q, um.qm, queue.DeadLetterRejected)
+			}
+			if rErr := ch.releaseUnacked(um); rErr != nil && err == nil {
+				err = rErr
+			}
+		}
+	}
+
+	ch.pingConsumers()
+	if err != nil {
+		return proto.NewSoftError(500, err.Error(), clsID, mtdID)
+	}
+	return nil
+}
+
+func (ch *Channel) basicGet(m *proto.BasicGet) *proto.Error {
+	clsID, mtdID := m.Identifier()
+
+	// Check queue
+	if len(m.Queue) == 0 {
+		if len(ch.usedQueueName) == 0 {
+			return proto.NewSoftError(404, "Queue not found", clsID, mtdID)
+		}
+		m.Queue = ch.usedQueueName
+	}
+
+	q, found := ch.server.getQueue(m.Queue)
+	if !found {
+		return proto.NewSoftError(404, "Queue not found", clsID, mtdID)
+	}
+
+	if q.ConnId != -1 && q.ConnId != ch.conn.id {
+		return proto.NewSoftError(405, "Queue is locked by another connection", clsID, mtdID)
+	}
+
+	// Fetched messages are not subject to the prefetch limits,
+	// so they hold no resources of the channel
+	qm, msg := q.GetOne()
+	if qm == nil {
+		ch.Send(&proto.BasicGetEmpty{})
+		return nil
+	}
+
+	deliveryTag := ch.GetDeliveryTag()
+
+	if m.NoAck {
+		rhs := []proto.MessageResourceHolder{}
+		if err := ch.server.msgStore.RemoveRef(qm, q.Name, rhs); err != nil {
+			return proto.NewSoftError(500, err.Error(), clsID, mtdID)
+		}
+	} else {
+		ch.AddUnackedMessage(deliveryTag, nil, qm, q.Name)
+	}
+
+	ch.SendContent(&proto.BasicGetOk{
+		DeliveryTag:  deliveryTag,
+		Redelivered:  qm.DeliveryCount > 0,
+		Exchange:     msg.Exchange,
+		RoutingKey:   msg.RoutingKey,
+		MessageCount: q.Len(),
+	}, msg)
+	return nil
+}
+
+func (ch *Channel) basicQos(m *proto.BasicQos) *proto.Error {
+	ch.setQos(m.PrefetchSize, m.PrefetchCount, m.Global)
+	ch.Send(&proto.BasicQosOk{})
 	return nil
 }
@@ -2,7 +2,10 @@ package server
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/sauravgsh16/message-server/proto"
 	"github.com/sauravgsh16/message-server/qserver/consumer"
@@ -16,6 +19,8 @@ const (
 	chClosed
 )
 
+const confirmBufferSize = 1024
+
 // Channel struct
 type Channel struct {
 	id            uint16
@@ -26,7 +31,7 @@ type Channel struct {
 	consumers     map[string]*consumer.Consumer
 	consumerMux   sync.Mutex
 	sendMux       sync.Mutex
-	state         uint8
+	state         uint32
 	curMsg        *proto.Message
 	flow          bool
 	usedQueueName string
@@ -34,33 +39,70 @@ type Channel struct {
 	tagMux        sync.Mutex
 	txMode        bool
 	txMessages    []*proto.TxMessage
+	txScheduled   []*proto.Message
 	txLock        sync.Mutex
-	defaultSize   uint32
+	prefetchSize  uint32
+	prefetchCount uint16
 	activeSize    uint32
+	activeCount   uint16
 	sizeMux       sync.Mutex
+	consumerQos   consumer.Qos
+	unacked       map[uint64]*unackedMessage
+	unackedMux    sync.Mutex
+	confirmMode   bool
+	publishSeq    uint64
+	confirms      chan *pendingConfirm
+	confirmMux    sync.Mutex
+	closed        chan struct{}
+}
+
+// unackedMessage struct holds a delivered message which is yet to be acknowledged
+type unackedMessage struct {
+	consumer  *consumer.Consumer
+	qm        *proto.QueueMessage
+	queueName string
+}
+
+// pendingConfirm struct holds a publisher confirm, which is sent
+// once the published message has been persisted
+type pendingConfirm struct {
+	tag       uint64
+	ack       bool
+	persisted <-chan struct{}
 }
 
 // NewChannel returns a new channel
 func NewChannel(id uint16, conn *Connection) *Channel {
 	return &Channel{
-		id:          id,
-		server:      conn.server,
-		incoming:    make(chan proto.Frame),
-		outgoing:    conn.outgoing,
-		conn:        conn,
-		consumers:   make(map[string]*consumer.Consumer),
-		flow:        true,
-		txMessages:  make([]*proto.TxMessage, 0),
-		defaultSize: uint32(2048),
+		id:         id,
+		server:     conn.server,
+		incoming:   make(chan proto.Frame),
+		outgoing:   conn.outgoing,
+		conn:       conn,
+		consumers:  make(map[string]*consumer.Consumer),
+		flow:       true,
+		txMessages: make([]*proto.TxMessage, 0),
+		unacked:    make(map[uint64]*unackedMessage),
+		closed:     make(chan struct{}),
 	}
 }
 
+// getState returns the state of the channel. The state is changed
+// by the channel, and by the connection when it shuts the channel down.
+func (ch *Channel) getState() uint32 {
+	return atomic.LoadUint32(&ch.state)
+}
+
+func (ch *Channel) setState(state uint32) {
+	atomic.StoreUint32(&ch.state, state)
+}
+
 // Send takes in a message frame and writes it on the connection
 func (ch *Channel) Send(msgf proto.MessageFrame) error {
 
 	fmt.Printf("Sending: %s\n", msgf.MethodName())
 
-	if ch.state == chClosed {
+	if ch.getState() == chClosed {
 		return ch.sendClosed(msgf)
 	}
 
@@ -104,10 +146,9 @@ func (ch *Channel) sendOpen(msgf proto.MessageFrame) error {
 			Properties: prop,
 		}
 
-		// Send Body
-		ch.outgoing <- &proto.BodyFrame{
-			ChannelID: ch.id,
-			Body:      body,
+		// Send Body, split to fit the frame max
+		for _, bf := range proto.BodyFrames(ch.id, body, ch.conn.maxFrameSize()) {
+			ch.outgoing <- bf
 		}
 	} else {
 		ch.outgoing <- &proto.MethodFrame{
@@ -141,36 +182,148 @@ func (ch *Channel) GetDeliveryTag() uint64 {
 	return ch.deliveryTag
 }
 
-// AcquireResources increments the active size of the message being sent if less than default allowed size
+// AcquireResources increments the active size and count of the messages being sent,
+// if they are within the prefetch limits of the channel. A zero limit means no limit.
 // Returns true if incremented, false otherwise
 func (ch *Channel) AcquireResources(qm *proto.QueueMessage) bool {
 	ch.sizeMux.Lock()
 	defer ch.sizeMux.Unlock()
 
-	if ch.activeSize < ch.defaultSize {
-		ch.activeSize += qm.MsgSize
-		return true
+	if ch.prefetchCount > 0 && ch.activeCount >= ch.prefetchCount {
+		return false
+	}
+	if ch.prefetchSize > 0 && ch.activeSize >= ch.prefetchSize {
+		return false
 	}
-	return false
+	ch.activeSize += qm.MsgSize
+	ch.activeCount++
+	return true
 }
 
-// ReleaseResources decrements the active message size by the current message being sent
+// ReleaseResources decrements the active message size and count by the current message being sent
 func (ch *Channel) ReleaseResources(qm *proto.QueueMessage) {
 	ch.sizeMux.Lock()
 	defer ch.sizeMux.Unlock()
 
 	ch.activeSize -= qm.MsgSize
+	ch.activeCount--
+}
+
+// setQos sets the prefetch limits. Global limits are shared by all consumers
+// of the channel, otherwise the limits apply to each consumer created afterwards.
+func (ch *Channel) setQos(prefetchSize uint32, prefetchCount uint16, global bool) {
+	ch.sizeMux.Lock()
+	if global {
+		ch.prefetchSize = prefetchSize
+		ch.prefetchCount = prefetchCount
+	} else {
+		ch.consumerQos = consumer.Qos{
+			PrefetchSize:  prefetchSize,
+			PrefetchCount: prefetchCount,
+		}
+	}
+	ch.sizeMux.Unlock()
+
+	// Limits could have been raised, consumers can try again
+	ch.pingConsumers()
+}
+
+// AddUnackedMessage records a delivered message against its delivery tag,
+// till the client acknowledges it
+func (ch *Channel) AddUnackedMessage(tag uint64, c *consumer.Consumer, qm *proto.QueueMessage, queueName string) {
+	ch.unackedMux.Lock()
+	defer ch.unackedMux.Unlock()
+
+	ch.unacked[tag] = &unackedMessage{
+		consumer:  c,
+		qm:        qm,
+		queueName: queueName,
+	}
+}
+
+// takeUnacked removes and returns the unacked messages for the delivery tag.
+// If multiple is set, all messages upto and including the tag are returned.
+// A zero tag with multiple set, returns all unacked messages.
+func (ch *Channel) takeUnacked(tag uint64, multiple bool) ([]*unackedMessage, bool) {
+	ch.unackedMux.Lock()
+	defer ch.unackedMux.Unlock()
+
+	if !multiple {
+		um, found := ch.unacked[tag]
+		if !found {
+			return nil, false
+		}
+		delete(ch.unacked, tag)
+		return []*unackedMessage{um}, true
+	}
+
+	tags := make([]uint64, 0, len(ch.unacked))
+	for t := range ch.unacked {
+		if tag == 0 || t <= tag {
+			tags = append(tags, t)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+	ums := make([]*unackedMessage, 0, len(tags))
+	for _, t := range tags {
+		ums = append(ums, ch.unacked[t])
+		delete(ch.unacked, t)
+	}
+	return ums, tag == 0 || len(ums) > 0
+}
+
+// resourceHolders returns the holders of resources for the unacked message.
+// Messages fetched with basic.get have no consumer, and hold no resources.
+func (um *unackedMessage) resourceHolders() []proto.MessageResourceHolder {
+	if um.consumer == nil {
+		return []proto.MessageResourceHolder{}
+	}
+	return um.consumer.ResourceHolders()
+}
+
+// releaseUnacked removes the message reference from the message store,
+// freeing resources held by the consumer and the channel
+func (ch *Channel) releaseUnacked(um *unackedMessage) error {
+	return ch.server.msgStore.RemoveRef(um.qm, um.queueName, um.resourceHolders())
+}
+
+// requeueUnacked frees resources held by the message and puts it back
+// at the head of its queue, to be delivered again
+func (ch *Channel) requeueUnacked(um *unackedMessage) error {
+	for _, rh := range um.resourceHolders() {
+		rh.ReleaseResources(um.qm)
+	}
+
+	ch.server.msgStore.IncrDeliveryCount(um.qm, um.queueName)
+
+	q, found := ch.server.getQueue(um.queueName)
+	if !found || !q.Requeue(um.qm) {
+		// Queue has been closed or deleted, we drop the message
+		return ch.server.msgStore.RemoveRef(um.qm, um.queueName, []proto.MessageResourceHolder{})
+	}
+	return nil
+}
+
+// pingConsumers notifies all consumers of the channel to resume consumption
+func (ch *Channel) pingConsumers() {
+	ch.consumerMux.Lock()
+	defer ch.consumerMux.Unlock()
+
+	for _, c := range ch.consumers {
+		c.Ping()
+	}
 }
 
 func (ch *Channel) start() {
-	if ch.state == 0 && ch.id == 0 {
-		ch.state = chOpen
+	if ch.getState() == chInit && ch.id == 0 {
+		ch.setState(chOpen)
 		go ch.startConnection()
 	}
 
 	go func() {
 		for {
-			if ch.state == chClosed {
+			if ch.getState() == chClosed {
 				break
 			}
 			var err *proto.Error
@@ -182,12 +335,12 @@ func (ch *Channel) start() {
 				err = ch.handleMethod(m)
 
 			case *proto.HeaderFrame:
-				if ch.state != chClosing {
+				if ch.getState() != chClosing {
 					err = ch.handleHeader(m)
 				}
 
 			case *proto.BodyFrame:
-				if ch.state != chClosing {
+				if ch.getState() != chClosing {
 					err = ch.handleBody(m)
 				}
 			default:
@@ -203,7 +356,7 @@ func (ch *Channel) start() {
 func (ch *Channel) sendError(err *proto.Error) {
 	if err.Soft {
 		fmt.Println("Sending channel error: ", err.Msg)
-		ch.state = chClosing
+		ch.setState(chClosing)
 		ch.Send(&proto.ChannelClose{
 			ReplyCode: err.Code,
 			ReplyText: err.Msg,
@@ -216,17 +369,31 @@ func (ch *Channel) sendError(err *proto.Error) {
 }
 
 func (ch *Channel) shutdown() {
-	if ch.state == chClosed {
+	if atomic.SwapUint32(&ch.state, chClosed) == chClosed {
 		fmt.Printf("channel already closed, shutdown performed on %d\n", ch.id)
 		return
 	}
-	ch.state = chClosed
+	// wake publishes waiting on a full confirm buffer
+	close(ch.closed)
 	// unregister channel from connection
 	ch.conn.removeChannel(ch.id)
-	// remove any consumer associated with this channel
+	// stop consumers, so that requeued messages are not delivered to them
+	for _, c := range ch.consumers {
+		c.Stop()
+	}
+	// requeue messages which were never acknowledged,
+	// in reverse so that they retain their original order
+	ums, _ := ch.takeUnacked(0, true)
+	for i := len(ums) - 1; i >= 0; i-- {
+		ch.requeueUnacked(ums[i])
+	}
+	// remove any consumer associated with this channel. Auto-delete
+	// queues losing their last consumer are deleted after the requeue.
 	for _, c := range ch.consumers {
 		ch.removeConsumer(c.ConsumerTag)
 	}
+	// stop sending publisher confirms
+	ch.stopConfirmMode()
 }
 
 func (ch *Channel) close(code uint16, text string, clsID uint16, mtdID uint16) {
@@ -236,13 +403,72 @@ func (ch *Channel) close(code uint16, text string, clsID uint16, mtdID uint16) {
 		ClassId:   clsID,
 		MethodId:  mtdID,
 	})
-	ch.state = chClosing
+	ch.setState(chClosing)
 }
 
 func (ch *Channel) startTxMode() {
 	ch.txMode = true
 }
 
+func (ch *Channel) startConfirmMode() {
+	ch.confirmMux.Lock()
+	defer ch.confirmMux.Unlock()
+
+	if ch.confirmMode {
+		return
+	}
+	ch.confirmMode = true
+	ch.confirms = make(chan *pendingConfirm, confirmBufferSize)
+	go ch.handleConfirms(ch.confirms)
+}
+
+// addConfirm numbers the publish and queues up its confirmation.
+// The confirmation is dropped if the channel shuts down while the
+// buffer is full, so the lock is never held past shutdown.
+func (ch *Channel) addConfirm(ack bool, persisted <-chan struct{}) {
+	ch.confirmMux.Lock()
+	defer ch.confirmMux.Unlock()
+
+	if ch.confirms == nil {
+		return
+	}
+	ch.publishSeq++
+	pc := &pendingConfirm{
+		tag:       ch.publishSeq,
+		ack:       ack,
+		persisted: persisted,
+	}
+	select {
+	case ch.confirms <- pc:
+	case <-ch.closed:
+	}
+}
+
+// handleConfirms sends confirmations in publish order,
+// waiting for each message to be persisted before acking it
+func (ch *Channel) handleConfirms(confirms <-chan *pendingConfirm) {
+	for pc := range confirms {
+		if pc.persisted != nil {
+			<-pc.persisted
+		}
+		if pc.ack {
+			ch.Send(&proto.BasicAck{DeliveryTag: pc.tag})
+		} else {
+			ch.Send(&proto.BasicNack{DeliveryTag: pc.tag})
+		}
+	}
+}
+
+func (ch *Channel) stopConfirmMode() {
+	ch.confirmMux.Lock()
+	defer ch.confirmMux.Unlock()
+
+	if ch.confirms != nil {
+		close(ch.confirms)
+		ch.confirms = nil
+	}
+}
+
 func (ch *Channel) commitTx(clsID, mtdID uint16) *proto.Error {
 
 	ch.txLock.Lock()
@@ -253,24 +479,34 @@ func (ch *Channel) commitTx(clsID, mtdID uint16) *proto.Error {
 		return proto.NewSoftError(500, err.Error(), clsID, mtdID)
 	}
 
+	rejected := make(map[int64]bool)
 	for qName, qMsgs := range qQueueMsgMap {
-		queue, found := ch.server.queues[qName]
-		if !found {
-			continue
-		}
 		for _, qMsg := range qMsgs {
-			if !queue.Add(qMsg) {
-				// If adding message to queue was not successful,
-				// It means queue was closed.
-				// We thus need to remove reference of the message store.
-				resourceHolder := []proto.MessageResourceHolder{ch}
-				ch.server.msgStore.RemoveRef(qMsg, qName, resourceHolder)
+			if ch.server.enqueue(qName, qMsg) {
+				rejected[qMsg.ID] = true
 			}
 		}
 	}
 
+	// Messages rejected by queues at their length limits are returned
+	for _, txMsg := range ch.txMessages {
+		if rejected[txMsg.Msg.ID] {
+			delete(rejected, txMsg.Msg.ID)
+			returnMtd := ch.server.basicReturnMsg(txMsg.Msg, replyQueueFull, "Queue length limit reached, message rejected")
+			ch.SendContent(returnMtd, txMsg.Msg)
+		}
+	}
+
+	for _, msg := range ch.txScheduled {
+		at, _, _ := deliverAt(msg)
+		if err := ch.server.schedule(msg, at); err != nil {
+			return proto.NewSoftError(500, err.Error(), clsID, mtdID)
+		}
+	}
+
 	// Clear transaction
 	ch.txMessages = make([]*proto.TxMessage, 0)
+	ch.txScheduled = nil
 
 	return nil
 }
@@ -280,6 +516,34 @@ func (ch *Channel) rollbackTx() *proto.Error {
 	defer ch.txLock.Unlock()
 
 	ch.txMessages = make([]*proto.TxMessage, 0)
+	ch.txScheduled = nil
+	return nil
+}
+
+// scheduleMsg schedules the current message to be routed at the given time.
+// In transaction mode, the message is scheduled when the transaction commits.
+func (ch *Channel) scheduleMsg(at time.Time) *proto.Error {
+	msg := ch.curMsg
+	ch.curMsg = nil
+
+	if ch.txMode {
+		ch.txLock.Lock()
+		ch.txScheduled = append(ch.txScheduled, msg)
+		ch.txLock.Unlock()
+		return nil
+	}
+
+	if err := ch.server.schedule(msg, at); err != nil {
+		if ch.confirmMode {
+			ch.addConfirm(false, nil)
+		}
+		clsID, mtdID := msg.Method.Identifier()
+		return proto.NewSoftError(500, err.Error(), clsID, mtdID)
+	}
+	if ch.confirmMode {
+		// The scheduled message is already persisted
+		ch.addConfirm(true, nil)
+	}
 	return nil
 }
 
@@ -300,7 +564,11 @@ func (ch *Channel) activateFlow(active bool) {
 func (ch *Channel) addNewConsumer(q *queue.Queue, m *proto.BasicConsume) *proto.Error {
 	clsID, mtdID := m.Identifier()
 
-	c := consumer.NewConsumer(ch.server.msgStore, ch, m.ConsumerTag, q, q.Name, m.NoAck, ch.defaultSize)
+	ch.sizeMux.Lock()
+	qos := ch.consumerQos
+	ch.sizeMux.Unlock()
+
+	c := consumer.NewConsumer(ch.server.msgStore, ch, m.ConsumerTag, q, q.Name, m.NoAck, qos)
 	ch.consumerMux.Lock()
 	defer ch.consumerMux.Unlock()
 
@@ -333,6 +601,9 @@ func (ch *Channel) removeConsumer(consumerTag string) error {
 	delete(ch.consumers, consumerTag)
 	ch.consumerMux.Unlock()
 
+	if q, found := ch.server.getQueue(c.QueueName()); found {
+		q.RemoveConsumer(consumerTag)
+	}
 	return nil
 }
 
@@ -351,7 +622,7 @@ func (ch *Channel) startConnection() *proto.Error {
 func (ch *Channel) handleMethod(mf *proto.MethodFrame) *proto.Error {
 
 	// Check if channel is in initial creation state
-	if ch.state == chInit && (mf.ClassID != 20 || mf.MethodID != 10) {
+	if ch.getState() == chInit && (mf.ClassID != 20 || mf.MethodID != 10) {
 		return proto.NewHardError(503, "Open method call on non-open channel", mf.ClassID, mf.MethodID)
 	}
 
@@ -371,6 +642,8 @@ func (ch *Channel) handleMethod(mf *proto.MethodFrame) *proto.Error {
 		return ch.basicRoute(mf.Method)
 	case 60:
 		return ch.txRoute(mf.Method)
+	case 85:
+		return ch.confirmRoute(mf.Method)
 	default:
 		return proto.NewHardError(540, "Not Implemented", mf.ClassID, mf.MethodID)
 	}
@@ -387,6 +660,17 @@ func (ch *Channel) handleHeader(hf *proto.HeaderFrame) *proto.Error {
 
 	ch.curMsg.Header = hf
 
+	if _, _, err := ch.curMsg.TTL(); err != nil {
+		clsID, mtdID := ch.curMsg.Method.Identifier()
+		ch.curMsg = nil
+		return proto.NewSoftError(406, err.Error(), clsID, mtdID)
+	}
+	if _, _, err := deliverAt(ch.curMsg); err != nil {
+		clsID, mtdID := ch.curMsg.Method.Identifier()
+		ch.curMsg = nil
+		return proto.NewSoftError(406, err.Error(), clsID, mtdID)
+	}
+
 	return nil
 }
 
@@ -407,12 +691,22 @@ func (ch *Channel) handleBody(bf *proto.BodyFrame) *proto.Error {
 	if size < ch.curMsg.Header.BodySize {
 		return nil
 	}
+	if size > ch.curMsg.Header.BodySize {
+		clsID, mtdID := ch.curMsg.Method.Identifier()
+		ch.curMsg = nil
+		return proto.NewHardError(proto.FrameErr, "Body exceeds the size in the content header", clsID, mtdID)
+	}
 
 	ex, _ := ch.server.getExchange(ch.curMsg.Method.(*proto.BasicPublish).Exchange)
 
+	// Delayed messages are routed once it is time
+	if at, delayed, _ := deliverAt(ch.curMsg); delayed {
+		return ch.scheduleMsg(at)
+	}
+
 	if ch.txMode {
 		// Add message to a List
-		queues, err := ex.QueuesToPublish(ch.curMsg)
+		queues, err := ex.QueuesToPublish(ch.curMsg, ch.server.getExchange)
 		if err != nil {
 			return err
 		}
@@ -428,12 +722,21 @@ func (ch *Channel) handleBody(bf *proto.BodyFrame) *proto.Error {
 		// Normal mode, publish directly
 		returnMtd, err := ch.server.publish(ex, ch.curMsg)
 		if err != nil {
+			if ch.confirmMode {
+				ch.addConfirm(false, nil)
+			}
 			ch.curMsg = nil
 			return err
 		}
-		if returnMtd != nil {
+		// Publishers in confirm mode learn about messages
+		// rejected by queues at their length limits from the nack
+		rejected := returnMtd != nil && returnMtd.ReplyCode == replyQueueFull
+		if returnMtd != nil && !(rejected && ch.confirmMode) {
 			ch.SendContent(returnMtd, ch.curMsg)
 		}
+		if ch.confirmMode {
+			ch.addConfirm(!rejected, ch.server.msgStore.Persisted())
+		}
 	}
 
 	ch.curMsg = nil
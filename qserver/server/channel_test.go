@@ -0,0 +1,107 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sauravgsh16/message-server/proto"
+)
+
+func TestShutdownWithFullConfirmBuffer(t *testing.T) {
+	// Nothing reads the connection, so the first confirm sent stalls
+	conn := NewConnection(nil, nil)
+	ch := NewChannel(1, conn)
+	ch.startConfirmMode()
+
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := 0; i < confirmBufferSize+10; i++ {
+			ch.addConfirm(true, nil)
+		}
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for len(ch.confirms) < confirmBufferSize {
+		select {
+		case <-deadline:
+			t.Fatalf("confirm buffer holds %d, never filled", len(ch.confirms))
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	shut := make(chan struct{})
+	go func() {
+		ch.shutdown()
+		close(shut)
+	}()
+
+	select {
+	case <-shut:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown blocked on a full confirm buffer")
+	}
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publish blocked on a full confirm buffer after shutdown")
+	}
+
+	// Publishes after shutdown are not confirmed
+	ch.addConfirm(true, nil)
+	if ch.confirms != nil {
+		t.Error("confirms still buffered after shutdown")
+	}
+}
+
+func TestTakeUnacked(t *testing.T) {
+	tests := []struct {
+		name      string
+		acked     []uint64
+		tag       uint64
+		multiple  bool
+		wantTags  []uint64
+		wantFound bool
+		wantLeft  int
+	}{
+		{"single", nil, 3, false, []uint64{3}, true, 4},
+		{"single not found", nil, 9, false, []uint64{}, false, 5},
+		{"single acked before", []uint64{3}, 3, false, []uint64{}, false, 4},
+		{"multiple upto the tag", nil, 4, true, []uint64{1, 2, 3, 4}, true, 1},
+		{"multiple over a gap", []uint64{3}, 4, true, []uint64{1, 2, 4}, true, 1},
+		{"multiple above every tag", nil, 9, true, []uint64{1, 2, 3, 4, 5}, true, 0},
+		{"multiple with nothing upto the tag", []uint64{1, 2}, 2, true, []uint64{}, false, 3},
+		{"multiple zero takes all", nil, 0, true, []uint64{1, 2, 3, 4, 5}, true, 0},
+		{"multiple zero with nothing unacked", []uint64{1, 2, 3, 4, 5}, 0, true, []uint64{}, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := NewChannel(1, NewConnection(nil, nil))
+			// Delivered out of order, multiple acks still take them by tag
+			for _, tag := range []uint64{5, 2, 4, 1, 3} {
+				ch.AddUnackedMessage(tag, nil, &proto.QueueMessage{ID: int64(tag)}, "q")
+			}
+			for _, tag := range tt.acked {
+				ch.takeUnacked(tag, false)
+			}
+
+			ums, found := ch.takeUnacked(tt.tag, tt.multiple)
+			if found != tt.wantFound {
+				t.Errorf("takeUnacked(%d, %v) found = %v, want %v", tt.tag, tt.multiple, found, tt.wantFound)
+			}
+			// The queue message ids are the delivery tags
+			got := make([]uint64, 0, len(ums))
+			for _, um := range ums {
+				got = append(got, uint64(um.qm.ID))
+			}
+			if !reflect.DeepEqual(got, tt.wantTags) {
+				t.Errorf("takeUnacked(%d, %v) = %v, want %v", tt.tag, tt.multiple, got, tt.wantTags)
+			}
+			if left := len(ch.unacked); left != tt.wantLeft {
+				t.Errorf("%d messages unacked after takeUnacked, want %d", left, tt.wantLeft)
+			}
+		})
+	}
+}
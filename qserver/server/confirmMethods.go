@@ -0,0 +1,30 @@
+package server
+
+import (
+	"github.com/sauravgsh16/message-server/proto"
+)
+
+func (ch *Channel) confirmRoute(msgf proto.MessageFrame) *proto.Error {
+	switch m := msgf.(type) {
+
+	case *proto.ConfirmSelect:
+		return ch.confirmSelect(m)
+
+	default:
+		clsID, mtdID := msgf.Identifier()
+		return proto.NewHardError(540, "unable to route method frame", clsID, mtdID)
+	}
+}
+
+func (ch *Channel) confirmSelect(m *proto.ConfirmSelect) *proto.Error {
+	if ch.txMode {
+		clsID, mtdID := m.Identifier()
+		return proto.NewSoftError(406, "Channel in transaction mode, cannot select confirm mode", clsID, mtdID)
+	}
+
+	ch.startConfirmMode()
+	if !m.NoWait {
+		ch.Send(&proto.ConfirmSelectOk{})
+	}
+	return nil
+}
@@ -26,12 +26,25 @@ func nextID() int64 {
 	return atomic.AddInt64(&counter, 1)
 }
 
+// Limits offered to clients with ConnectionTune
+const (
+	serverFrameMax   = 128 * 1024
+	serverChannelMax = 2047
+	// serverHeartbeat is the heartbeat interval in seconds
+	serverHeartbeat = 60
+)
+
+// heartbeatMisses is the number of heartbeat intervals without
+// any frame from the client, after which the client is taken as dead
+const heartbeatMisses = 2
+
 // ConnectionStatus struct
 type ConnectionStatus struct {
 	start    bool
 	startOk  bool
 	open     bool
 	openOk   bool
+	tuned    bool
 	closing  bool
 	closed   bool
 	closedOk bool
@@ -39,15 +52,21 @@ type ConnectionStatus struct {
 
 // Connection struct
 type Connection struct {
-	id        int64
-	channels  map[uint16]*Channel
-	outgoing  chan proto.Frame
-	server    *Server
-	network   net.Conn
-	mux       sync.Mutex
-	allocator allocate.Allocator
-	status    ConnectionStatus
-	writer    *proto.Writer
+	id         int64
+	channels   map[uint16]*Channel
+	outgoing   chan proto.Frame
+	server     *Server
+	network    net.Conn
+	mux        sync.Mutex
+	destructor sync.Once
+	allocator  allocate.Allocator
+	status     ConnectionStatus
+	statusMux  sync.RWMutex
+	writer     *proto.Writer
+	frameMax   uint32
+	channelMax uint32
+	lastSent   int64
+	lastRecv   int64
 }
 
 // NewConnection returns a new connection
@@ -60,9 +79,49 @@ func NewConnection(s *Server, n net.Conn) *Connection {
 		network:  n,
 		status:   ConnectionStatus{},
 		writer:   &proto.Writer{W: bufio.NewWriter(n)},
+		frameMax: proto.FrameMinSize,
 	}
 }
 
+// tune sets the frame max and channel max negotiated with the client
+func (c *Connection) tune(frameMax uint32, channelMax uint16) {
+	atomic.StoreUint32(&c.frameMax, frameMax)
+	atomic.StoreUint32(&c.channelMax, uint32(channelMax))
+}
+
+// maxFrameSize returns the largest frame sent or received on the connection
+func (c *Connection) maxFrameSize() uint32 {
+	return atomic.LoadUint32(&c.frameMax)
+}
+
+// maxChannels returns the highest channel id allowed. Zero means
+// the connection is yet to be tuned.
+func (c *Connection) maxChannels() uint32 {
+	return atomic.LoadUint32(&c.channelMax)
+}
+
+// getStatus returns a copy of the connection status
+func (c *Connection) getStatus() ConnectionStatus {
+	c.statusMux.RLock()
+	defer c.statusMux.RUnlock()
+	return c.status
+}
+
+// updateStatus changes the connection status under the status lock
+func (c *Connection) updateStatus(update func(status *ConnectionStatus)) {
+	c.statusMux.Lock()
+	defer c.statusMux.Unlock()
+	update(&c.status)
+}
+
+// channel returns the open channel with the id
+func (c *Connection) channel(chID uint16) (*Channel, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	ch, ok := c.channels[chID]
+	return ch, ok
+}
+
 func (c *Connection) openConnection() {
 
 	// Protocol Handshake
@@ -89,24 +148,43 @@ func (c *Connection) openConnection() {
 	c.handleOutgoing()
 }
 
+// hardClose closes the network connection and shuts down its channels.
+// It can be called from any goroutine, only the first call takes effect.
 func (c *Connection) hardClose() {
-	if c.status.closed {
-		return
-	}
+	c.destructor.Do(func() {
+		c.updateStatus(func(status *ConnectionStatus) {
+			status.closed = true
+		})
 
-	c.network.Close()
-	c.status.closed = true
-	c.server.deleteConnection(c.id)
-	c.server.deleteQueuesForConn(c.id)
-	for _, ch := range c.channels {
-		ch.shutdown()
-	}
+		c.network.Close()
+		c.server.deleteConnection(c.id)
+		c.server.deleteQueuesForConn(c.id)
+
+		// Channels remove themselves from the connection as they shut down
+		c.mux.Lock()
+		channels := make([]*Channel, 0, len(c.channels))
+		for _, ch := range c.channels {
+			channels = append(channels, ch)
+		}
+		c.mux.Unlock()
+
+		for _, ch := range channels {
+			ch.shutdown()
+		}
+	})
 }
 
 func (c *Connection) closeConnWithError(err *proto.Error) {
 	fmt.Println("Sending connection close: ", err.Msg, err.Class, err.Method)
-	c.status.closing = true
-	c.channels[0].Send(&proto.ConnectionClose{
+	c.updateStatus(func(status *ConnectionStatus) {
+		status.closing = true
+	})
+	ch0, ok := c.channel(0)
+	if !ok {
+		// Connection has already been closed
+		return
+	}
+	ch0.Send(&proto.ConnectionClose{
 		ReplyCode: err.Code,
 		ReplyText: err.Msg,
 		ClassId:   err.Class,
@@ -121,36 +199,69 @@ func (c *Connection) removeChannel(chID uint16) {
 }
 
 func (c *Connection) send(f proto.Frame) error {
-	if c.status.closed {
+	if c.getStatus().closed {
 		return proto.NewHardError(500, "Sending on closed channel/Connection", 0, 0)
 	}
 
 	c.mux.Lock()
 	err := c.writer.WriteFrame(f)
 	c.mux.Unlock()
-	if err != nil || c.status.closing == true {
+	if err != nil || c.getStatus().closing {
 		go c.hardClose()
 	}
+	atomic.StoreInt64(&c.lastSent, time.Now().UnixNano())
 	return err
 }
 
+// heartbeat sends heartbeats while the connection is idle, and closes
+// the connection once nothing is heard from the client for heartbeatMisses intervals
+func (c *Connection) heartbeat(interval time.Duration) {
+	now := time.Now().UnixNano()
+	atomic.StoreInt64(&c.lastSent, now)
+	atomic.StoreInt64(&c.lastRecv, now)
+
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if c.getStatus().closed {
+			return
+		}
+
+		if time.Since(time.Unix(0, atomic.LoadInt64(&c.lastRecv))) >= heartbeatMisses*interval {
+			fmt.Printf("Missed heartbeats, closing connection %d\n", c.id)
+			c.hardClose()
+			return
+		}
+
+		if time.Since(time.Unix(0, atomic.LoadInt64(&c.lastSent))) >= interval {
+			if err := c.send(&proto.HeartbeatFrame{}); err != nil {
+				return
+			}
+		}
+	}
+}
+
 func (c *Connection) handleIncoming(r io.Reader) {
 
 	buf := bufio.NewReader(r)
 	frames := &proto.Reader{R: buf}
 
 	for {
-		if c.status.closed {
+		if c.getStatus().closed {
 			break
 		}
+		frames.FrameMax = c.maxFrameSize()
 		frame, err := frames.ReadFrame()
 		if err != nil {
-			if _, ok := err.(*net.OpError); ok {
-				continue
+			if pErr, ok := err.(*proto.Error); ok {
+				c.closeConnWithError(pErr)
+				break
 			}
 			c.hardClose()
 			break
 		}
+		atomic.StoreInt64(&c.lastRecv, time.Now().UnixNano())
 		c.handleFrame(frame)
 	}
 }
@@ -158,7 +269,7 @@ func (c *Connection) handleIncoming(r io.Reader) {
 func (c *Connection) handleOutgoing() {
 	go func() {
 		for {
-			if c.status.closed {
+			if c.getStatus().closed {
 				break
 			}
 			frame := <-c.outgoing
@@ -168,16 +279,26 @@ func (c *Connection) handleOutgoing() {
 }
 
 func (c *Connection) handleFrame(f proto.Frame) {
-	if !c.status.open && f.Channel() != 0 {
+	// Heartbeats only tell that the client is alive
+	if _, ok := f.(*proto.HeartbeatFrame); ok {
+		return
+	}
+	if !c.getStatus().open && f.Channel() != 0 {
 		c.hardClose()
 		return
 	}
+	if uint32(f.Channel()) > c.maxChannels() && f.Channel() != 0 {
+		c.closeConnWithError(proto.NewHardError(504, fmt.Sprintf("Channel %d exceeds channel max %d", f.Channel(), c.maxChannels()), 0, 0))
+		return
+	}
+	c.mux.Lock()
 	ch, ok := c.channels[f.Channel()]
 	if !ok {
 		ch = NewChannel(f.Channel(), c)
 		c.channels[f.Channel()] = ch
-		c.channels[f.Channel()].start()
+		ch.start()
 	}
+	c.mux.Unlock()
 	// Dispatch frame to channel
 	ch.incoming <- f
 }
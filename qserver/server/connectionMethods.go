@@ -1,6 +1,9 @@
 package server
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/sauravgsh16/message-server/proto"
 )
 
@@ -10,6 +13,9 @@ func (ch *Channel) connRoute(conn *Connection, msgf proto.MessageFrame) *proto.E
 	case *proto.ConnectionStartOk:
 		return ch.connStartOk(conn, m)
 
+	case *proto.ConnectionTuneOk:
+		return ch.connTuneOk(conn, m)
+
 	case *proto.ConnectionOpen:
 		return ch.connOpen(conn, m)
 
@@ -28,27 +34,71 @@ func (ch *Channel) connRoute(conn *Connection, msgf proto.MessageFrame) *proto.E
 func (ch *Channel) connOpen(c *Connection, m *proto.ConnectionOpen) *proto.Error {
 	// TODO : check if m.Host is accessible.
 	// If not, then close connection - break
-	c.status.open = true
+	if !c.getStatus().tuned {
+		clsID, mtdID := m.Identifier()
+		return proto.NewHardError(503, "Connection opened before tuning", clsID, mtdID)
+	}
+	c.updateStatus(func(status *ConnectionStatus) {
+		status.open = true
+	})
 	ch.Send(&proto.ConnectionOpenOk{Response: "Connected"})
-	c.status.openOk = true
+	c.updateStatus(func(status *ConnectionStatus) {
+		status.openOk = true
+	})
 	return nil
 }
 
 func (ch *Channel) connStartOk(c *Connection, m *proto.ConnectionStartOk) *proto.Error {
-	c.status.startOk = true
+	c.updateStatus(func(status *ConnectionStatus) {
+		status.startOk = true
+	})
 
 	if m.Mechanism != "PLAIN" {
 		c.hardClose()
+		return nil
+	}
+
+	ch.Send(&proto.ConnectionTune{
+		ChannelMax: serverChannelMax,
+		FrameMax:   serverFrameMax,
+		Heartbeat:  serverHeartbeat,
+	})
+	return nil
+}
+
+// connTuneOk applies the limits the client accepted. The client can lower
+// the limits offered in ConnectionTune, but never raise them. Zero means no limit.
+// The heartbeat interval is the client's choice up to the one offered,
+// with zero turning heartbeats off.
+func (ch *Channel) connTuneOk(c *Connection, m *proto.ConnectionTuneOk) *proto.Error {
+	clsID, mtdID := m.Identifier()
+
+	if m.FrameMax == 0 || m.FrameMax > serverFrameMax || m.FrameMax < proto.FrameMinSize {
+		return proto.NewHardError(530, fmt.Sprintf("Frame max %d not within %d and %d", m.FrameMax, proto.FrameMinSize, serverFrameMax), clsID, mtdID)
+	}
+	if m.ChannelMax == 0 || m.ChannelMax > serverChannelMax {
+		return proto.NewHardError(530, fmt.Sprintf("Channel max %d not within 1 and %d", m.ChannelMax, serverChannelMax), clsID, mtdID)
+	}
+	if m.Heartbeat > serverHeartbeat {
+		return proto.NewHardError(530, fmt.Sprintf("Heartbeat %d above %d", m.Heartbeat, serverHeartbeat), clsID, mtdID)
+	}
+
+	c.tune(m.FrameMax, m.ChannelMax)
+	c.updateStatus(func(status *ConnectionStatus) {
+		status.tuned = true
+	})
+
+	if m.Heartbeat > 0 {
+		go c.heartbeat(time.Duration(m.Heartbeat) * time.Second)
 	}
 	return nil
 }
 
 func (ch *Channel) connClose(c *Connection, m *proto.ConnectionClose) *proto.Error {
 	ch.Send(&proto.ConnectionCloseOk{})
-	c.mux.Lock()
-	defer c.mux.Unlock()
-
-	c.status.closing = true
+	c.updateStatus(func(status *ConnectionStatus) {
+		status.closing = true
+	})
 
 	return nil
 }
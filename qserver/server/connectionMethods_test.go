@@ -0,0 +1,49 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/sauravgsh16/message-server/proto"
+)
+
+func TestConnTuneOkLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		tuneOk   proto.ConnectionTuneOk
+		wantCode uint16
+	}{
+		{"offered limits", proto.ConnectionTuneOk{FrameMax: serverFrameMax, ChannelMax: serverChannelMax}, 0},
+		{"lowered limits", proto.ConnectionTuneOk{FrameMax: proto.FrameMinSize, ChannelMax: 1}, 0},
+		{"frame max zero", proto.ConnectionTuneOk{FrameMax: 0, ChannelMax: 1}, 530},
+		{"frame max below minimum", proto.ConnectionTuneOk{FrameMax: proto.FrameMinSize - 1, ChannelMax: 1}, 530},
+		{"frame max above offer", proto.ConnectionTuneOk{FrameMax: serverFrameMax + 1, ChannelMax: 1}, 530},
+		{"channel max zero", proto.ConnectionTuneOk{FrameMax: serverFrameMax, ChannelMax: 0}, 530},
+		{"channel max above offer", proto.ConnectionTuneOk{FrameMax: serverFrameMax, ChannelMax: serverChannelMax + 1}, 530},
+		{"heartbeat above offer", proto.ConnectionTuneOk{FrameMax: serverFrameMax, ChannelMax: 1, Heartbeat: serverHeartbeat + 1}, 530},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConnection(nil, nil)
+			ch := NewChannel(0, c)
+			m := tt.tuneOk
+
+			err := ch.connTuneOk(c, &m)
+			if tt.wantCode == 0 {
+				if err != nil {
+					t.Fatalf("connTuneOk() = %v, want no error", err)
+				}
+				if !c.getStatus().tuned {
+					t.Error("connection not marked tuned")
+				}
+				return
+			}
+			if err == nil || err.Code != tt.wantCode {
+				t.Fatalf("connTuneOk() = %v, want code %d", err, tt.wantCode)
+			}
+			if c.getStatus().tuned {
+				t.Error("connection marked tuned after rejected limits")
+			}
+		})
+	}
+}
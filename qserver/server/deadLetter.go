@@ -0,0 +1,121 @@
+package server
+
+import (
+	"time"
+
+	"github.com/sauravgsh16/message-server/proto"
+	"github.com/sauravgsh16/message-server/qserver/queue"
+)
+
+// xDeath is the message header holding the dead letter history,
+// with the most recent entry first
+const xDeath = "x-death"
+
+// deadLetter republishes the message to the dead letter exchange of the queue.
+// It does not remove the message from the queue, the caller still holds its reference.
+func (s *Server) deadLetter(q *queue.Queue, qm *proto.QueueMessage, reason string) {
+	if len(q.DeadLetterExchange) == 0 {
+		return
+	}
+
+	msg, found := s.msgStore.GetMsg(qm.ID)
+	if !found || msg.Header == nil {
+		return
+	}
+
+	ex, found := s.getExchange(q.DeadLetterExchange)
+	if !found || ex.Closed {
+		return
+	}
+
+	headers := msg.Header.Properties.Headers
+
+	// Messages which come back to the queue without being
+	// rejected on the way are in a cycle, we drop them instead
+	if reason != queue.DeadLetterRejected && inDeadLetterCycle(headers, q.Name) {
+		return
+	}
+
+	routingKey := q.DeadLetterRoutingKey
+	if len(routingKey) == 0 {
+		routingKey = msg.RoutingKey
+	}
+
+	dlMsg := proto.NewMessage(&proto.BasicPublish{
+		Exchange:   ex.Name,
+		RoutingKey: routingKey,
+	})
+	dlMsg.Payload = msg.Payload
+	dlMsg.Header = &proto.HeaderFrame{
+		Class:      msg.Header.Class,
+		BodySize:   msg.Header.BodySize,
+		Properties: msg.Header.Properties,
+	}
+	dlMsg.Header.Properties.Headers = addDeath(headers, reason, q.Name, msg)
+	// The message must not expire again in the queues it is dead lettered to
+	dlMsg.Header.Properties.Expiration = ""
+
+	// Dead lettered messages which cannot be routed are dropped
+	s.publish(ex, dlMsg)
+}
+
+// addDeath returns a copy of the headers, with the death of
+// the message recorded in the x-death history
+func addDeath(headers proto.Table, reason, queueName string, msg *proto.Message) proto.Table {
+	updated := make(proto.Table, len(headers)+1)
+	for k, v := range headers {
+		updated[k] = v
+	}
+
+	deaths, _ := headers[xDeath].([]interface{})
+	count := int64(1)
+	history := make([]interface{}, 0, len(deaths)+1)
+
+	// Deaths from the same queue for the same reason are counted in a single entry
+	for _, d := range deaths {
+		death, ok := d.(proto.Table)
+		if ok && death["queue"] == queueName && death["reason"] == reason {
+			if c, ok := death["count"].(int64); ok {
+				count += c
+			}
+			continue
+		}
+		history = append(history, d)
+	}
+
+	death := proto.Table{
+		"reason":       reason,
+		"queue":        queueName,
+		"exchange":     msg.Exchange,
+		"routing-keys": []interface{}{msg.RoutingKey},
+		"count":        count,
+		"time":         time.Now(),
+	}
+	if expiration := msg.Header.Properties.Expiration; len(expiration) > 0 {
+		death["original-expiration"] = expiration
+	}
+	updated[xDeath] = append([]interface{}{death}, history...)
+	return updated
+}
+
+// inDeadLetterCycle returns true if the message has died in the queue before,
+// and was not rejected anywhere since. The deaths since then are the entries
+// from the most recent one back to the previous death in the queue, as an
+// entry moves to the front of the history each time it is counted again.
+func inDeadLetterCycle(headers proto.Table, queueName string) bool {
+	deaths, _ := headers[xDeath].([]interface{})
+
+	for _, d := range deaths {
+		death, ok := d.(proto.Table)
+		if !ok {
+			continue
+		}
+		if death["reason"] == queue.DeadLetterRejected {
+			return false
+		}
+		if death["queue"] == queueName {
+			return true
+		}
+	}
+	return false
+}
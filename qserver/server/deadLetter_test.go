@@ -0,0 +1,177 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sauravgsh16/message-server/proto"
+	"github.com/sauravgsh16/message-server/qserver/queue"
+)
+
+// death returns an x-death entry of the queue for the reason
+func death(queueName, reason string) proto.Table {
+	return proto.Table{"queue": queueName, "reason": reason, "count": int64(1)}
+}
+
+// deathsOf returns the queue and reason of each x-death entry, most recent first
+func deathsOf(t *testing.T, headers proto.Table) [][2]interface{} {
+	deaths, ok := headers[xDeath].([]interface{})
+	if !ok {
+		t.Fatalf("x-death is %T, want an array", headers[xDeath])
+	}
+	got := make([][2]interface{}, 0, len(deaths))
+	for _, d := range deaths {
+		entry := d.(proto.Table)
+		got = append(got, [2]interface{}{entry["queue"], entry["reason"]})
+	}
+	return got
+}
+
+func deadMessage(expiration string) *proto.Message {
+	msg := proto.NewMessage(&proto.BasicPublish{Exchange: "ex", RoutingKey: "key"})
+	msg.Header = &proto.HeaderFrame{Properties: proto.Properties{Expiration: expiration}}
+	return msg
+}
+
+func TestAddDeathFirst(t *testing.T) {
+	headers := proto.Table{"app": "billing"}
+
+	updated := addDeath(headers, queue.DeadLetterExpired, "q1", deadMessage("100"))
+
+	if _, found := headers[xDeath]; found {
+		t.Error("addDeath modified the headers it was given")
+	}
+	if updated["app"] != "billing" {
+		t.Errorf("header app = %v after addDeath, want billing", updated["app"])
+	}
+
+	deaths := updated[xDeath].([]interface{})
+	if len(deaths) != 1 {
+		t.Fatalf("x-death holds %d entries, want 1", len(deaths))
+	}
+	entry := deaths[0].(proto.Table)
+	want := map[string]interface{}{
+		"queue":               "q1",
+		"reason":              queue.DeadLetterExpired,
+		"exchange":            "ex",
+		"count":               int64(1),
+		"original-expiration": "100",
+	}
+	for k, v := range want {
+		if !reflect.DeepEqual(entry[k], v) {
+			t.Errorf("x-death %s = %#v, want %#v", k, entry[k], v)
+		}
+	}
+	if keys := entry["routing-keys"]; !reflect.DeepEqual(keys, []interface{}{"key"}) {
+		t.Errorf("x-death routing-keys = %#v, want [key]", keys)
+	}
+	if _, found := entry["time"]; !found {
+		t.Error("x-death entry has no time")
+	}
+
+	// Messages without an expiration have no original expiration recorded
+	entry = addDeath(nil, queue.DeadLetterRejected, "q1", deadMessage(""))[xDeath].([]interface{})[0].(proto.Table)
+	if _, found := entry["original-expiration"]; found {
+		t.Error("original-expiration recorded for a message without an expiration")
+	}
+}
+
+func TestAddDeathCountsRepeats(t *testing.T) {
+	msg := deadMessage("")
+	headers := addDeath(nil, queue.DeadLetterExpired, "q1", msg)
+	headers = addDeath(headers, queue.DeadLetterRejected, "q2", msg)
+	headers = addDeath(headers, queue.DeadLetterExpired, "q1", msg)
+	headers = addDeath(headers, queue.DeadLetterMaxLen, "q1", msg)
+
+	// The repeated death moves to the front, and others keep their order
+	want := [][2]interface{}{
+		{"q1", queue.DeadLetterMaxLen},
+		{"q1", queue.DeadLetterExpired},
+		{"q2", queue.DeadLetterRejected},
+	}
+	if got := deathsOf(t, headers); !reflect.DeepEqual(got, want) {
+		t.Fatalf("x-death = %v, want %v", got, want)
+	}
+
+	counts := make([]interface{}, 0)
+	for _, d := range headers[xDeath].([]interface{}) {
+		counts = append(counts, d.(proto.Table)["count"])
+	}
+	if want := []interface{}{int64(1), int64(2), int64(1)}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("x-death counts = %v, want %v", counts, want)
+	}
+}
+
+func TestInDeadLetterCycle(t *testing.T) {
+	tests := []struct {
+		name   string
+		deaths []interface{}
+		want   bool
+	}{
+		{"no history", nil, false},
+		{"died in another queue", []interface{}{death("q2", queue.DeadLetterExpired)}, false},
+		{"died here before", []interface{}{death("q1", queue.DeadLetterExpired)}, true},
+		{"died here for another reason", []interface{}{death("q1", queue.DeadLetterMaxLen)}, true},
+		{"rejected here before", []interface{}{death("q1", queue.DeadLetterRejected)}, false},
+		{
+			"back through another queue",
+			[]interface{}{death("q2", queue.DeadLetterExpired), death("q1", queue.DeadLetterExpired)},
+			true,
+		},
+		{
+			"rejected on the way back",
+			[]interface{}{death("q2", queue.DeadLetterRejected), death("q1", queue.DeadLetterExpired)},
+			false,
+		},
+		{
+			"rejected before the previous death here",
+			[]interface{}{death("q1", queue.DeadLetterExpired), death("q2", queue.DeadLetterRejected)},
+			true,
+		},
+		{
+			"rejected in an earlier hop of the cycle",
+			[]interface{}{
+				death("q3", queue.DeadLetterExpired),
+				death("q1", queue.DeadLetterExpired),
+				death("q2", queue.DeadLetterRejected),
+			},
+			true,
+		},
+		{
+			"entries which are not tables",
+			[]interface{}{"bad", death("q1", queue.DeadLetterExpired)},
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := proto.Table{}
+			if tt.deaths != nil {
+				headers[xDeath] = tt.deaths
+			}
+			if got := inDeadLetterCycle(headers, "q1"); got != tt.want {
+				t.Errorf("inDeadLetterCycle(%v, q1) = %v, want %v", tt.deaths, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInDeadLetterCycleAfterRejection(t *testing.T) {
+	// Rejected once from q2 to q1, then expiring between q1 and q2
+	msg := deadMessage("")
+	headers := addDeath(nil, queue.DeadLetterRejected, "q2", msg)
+	if inDeadLetterCycle(headers, "q1") {
+		t.Fatal("first expiry in q1 taken as a cycle")
+	}
+	headers = addDeath(headers, queue.DeadLetterExpired, "q1", msg)
+	if inDeadLetterCycle(headers, "q2") {
+		t.Fatal("expiry in q2 right after its rejection taken as a cycle")
+	}
+	headers = addDeath(headers, queue.DeadLetterExpired, "q2", msg)
+
+	// Back in q1 with nothing rejected since it last expired there
+	if !inDeadLetterCycle(headers, "q1") {
+		t.Errorf("cycle not found with x-death %v", deathsOf(t, headers))
+	}
+}
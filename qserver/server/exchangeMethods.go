@@ -1,7 +1,10 @@
 package server
 
 import (
+	"fmt"
+
 	"github.com/sauravgsh16/message-server/proto"
+	"github.com/sauravgsh16/message-server/qserver/binding"
 	"github.com/sauravgsh16/message-server/qserver/exchange"
 )
 
@@ -32,6 +35,18 @@ func (ch *Channel) exDeclare(m *proto.ExchangeDeclare) *proto.Error {
 
 	// Check if exchange is already present in Server
 	declared, hasEx := ch.server.getExchange(m.Exchange)
+
+	// A passive declare only checks that the exchange exists
+	if m.Passive {
+		if !hasEx {
+			return proto.NewSoftError(404, fmt.Sprintf("Exchange: %s - not found", m.Exchange), clsID, mtdID)
+		}
+		if !m.NoWait {
+			ch.Send(ch.exchangeDeclareOk(declared))
+		}
+		return nil
+	}
+
 	if hasEx {
 		// Check if existing exchange and new exchange have different type
 		extype, err := exchange.GetExType(m.Type)
@@ -41,10 +56,16 @@ func (ch *Channel) exDeclare(m *proto.ExchangeDeclare) *proto.Error {
 		if declared.ExType != extype {
 			return proto.NewHardError(406, "Existing and new exchange have different types", clsID, mtdID)
 		}
+		if declared.Durable != m.Durable {
+			return proto.NewSoftError(406, "Existing and new exchange have different durability", clsID, mtdID)
+		}
+		if !declared.EqualArguments(m.Arguments) {
+			return proto.NewSoftError(406, "Existing and new exchange have different arguments", clsID, mtdID)
+		}
 
 		if declared.Name == m.Exchange {
 			if !m.NoWait {
-				ch.Send(&proto.ExchangeDeclareOk{})
+				ch.Send(ch.exchangeDeclareOk(declared))
 			}
 		}
 		return nil
@@ -56,6 +77,12 @@ func (ch *Channel) exDeclare(m *proto.ExchangeDeclare) *proto.Error {
 		return pErr
 	}
 
+	if ex.Durable {
+		if err := ch.server.persistExchange(ex); err != nil {
+			return proto.NewSoftError(500, err.Error(), clsID, mtdID)
+		}
+	}
+
 	err := ch.server.addExchange(ex)
 	if err != nil {
 		return proto.NewSoftError(500, err.Error(), clsID, mtdID)
@@ -66,6 +93,15 @@ func (ch *Channel) exDeclare(m *proto.ExchangeDeclare) *proto.Error {
 	return nil
 }
 
+// exchangeDeclareOk reports the bindings of the exchange, and the
+// scheduled messages waiting to be routed through it
+func (ch *Channel) exchangeDeclareOk(ex *exchange.Exchange) *proto.ExchangeDeclareOk {
+	return &proto.ExchangeDeclareOk{
+		BindingCnt:   ex.BindingCount(),
+		ScheduledCnt: ch.server.scheduledCount(ex.Name),
+	}
+}
+
 func (ch *Channel) exDelete(m *proto.ExchangeDelete) *proto.Error {
 	clsID, mtdID := m.Identifier()
 	errCode, err := ch.server.deleteExchange(m)
@@ -79,11 +115,74 @@ func (ch *Channel) exDelete(m *proto.ExchangeDelete) *proto.Error {
 }
 
 func (ch *Channel) exBind(m *proto.ExchangeBind) *proto.Error {
-	cls, mtd := m.Identifier()
-	return proto.NewHardError(540, "Not Implemented", cls, mtd)
+	clsID, mtdID := m.Identifier()
+
+	// The default exchange can neither be bound nor bound to
+	if m.Source == "" || m.Destination == "" {
+		return proto.NewSoftError(403, "Cannot bind the default exchange", clsID, mtdID)
+	}
+
+	source, found := ch.server.getExchange(m.Source)
+	if !found {
+		return proto.NewSoftError(404, fmt.Sprintf("Exchange: %s - not found", m.Source), clsID, mtdID)
+	}
+
+	dest, found := ch.server.getExchange(m.Destination)
+	if !found {
+		return proto.NewSoftError(404, fmt.Sprintf("Exchange: %s - not found", m.Destination), clsID, mtdID)
+	}
+
+	if err := binding.CheckArguments(m.Arguments); err != nil {
+		return proto.NewSoftError(406, err.Error(), clsID, mtdID)
+	}
+
+	b, err := binding.NewExchangeBinding(m.Destination, m.Source, m.RoutingKey, m.Arguments)
+	if err != nil {
+		return proto.NewSoftError(500, err.Error(), clsID, mtdID)
+	}
+
+	// Bindings between durable exchanges are durable
+	if source.Durable && dest.Durable {
+		if err := ch.server.persistBinding(b); err != nil {
+			return proto.NewSoftError(500, err.Error(), clsID, mtdID)
+		}
+	}
+
+	if err := source.AddBinding(b, ch.conn.id); err != nil {
+		return proto.NewSoftError(500, err.Error(), clsID, mtdID)
+	}
+
+	if !m.NoWait {
+		ch.Send(&proto.ExchangeBindOk{})
+	}
+	return nil
 }
 
 func (ch *Channel) exUnbind(m *proto.ExchangeUnbind) *proto.Error {
-	cls, mtd := m.Identifier()
-	return proto.NewHardError(540, "Not Implemented", cls, mtd)
+	clsID, mtdID := m.Identifier()
+
+	source, found := ch.server.getExchange(m.Source)
+	if !found {
+		return proto.NewSoftError(404, fmt.Sprintf("Exchange: %s - not found", m.Source), clsID, mtdID)
+	}
+
+	b, err := binding.NewExchangeBinding(m.Destination, m.Source, m.RoutingKey, m.Arguments)
+	if err != nil {
+		return proto.NewSoftError(500, err.Error(), clsID, mtdID)
+	}
+
+	if source.Durable {
+		if err := ch.server.depersistBinding(b); err != nil {
+			return proto.NewSoftError(500, err.Error(), clsID, mtdID)
+		}
+	}
+
+	if err := source.RemoveBinding(b); err != nil {
+		return proto.NewSoftError(500, err.Error(), clsID, mtdID)
+	}
+
+	if !m.NoWait {
+		ch.Send(&proto.ExchangeUnbindOk{})
+	}
+	return nil
 }
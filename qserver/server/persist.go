@@ -0,0 +1,294 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/sauravgsh16/message-server/proto"
+	"github.com/sauravgsh16/message-server/qserver/binding"
+	"github.com/sauravgsh16/message-server/qserver/exchange"
+	"github.com/sauravgsh16/message-server/qserver/queue"
+)
+
+var EXCHANGES_BUCKET = []byte("exchanges")
+var QUEUES_BUCKET = []byte("queues")
+var BINDINGS_BUCKET = []byte("bindings")
+
+// Exchanges, queues and bindings are all persisted as the method which
+// declares them, encoded as the class and method ids followed by the method
+
+// encodeDeclare returns the declaring method encoded for persisting
+func encodeDeclare(mf proto.MessageFrame) ([]byte, error) {
+	var buf bytes.Buffer
+
+	clsID, mtdID := mf.Identifier()
+	proto.WriteShort(&buf, clsID)
+	proto.WriteShort(&buf, mtdID)
+	if err := mf.Write(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeDeclare reads the persisted method into mf,
+// failing if the record holds a different method
+func decodeDeclare(data []byte, mf proto.MessageFrame) error {
+	r := bytes.NewReader(data)
+
+	clsID, err := proto.ReadShort(r)
+	if err != nil {
+		return err
+	}
+	mtdID, err := proto.ReadShort(r)
+	if err != nil {
+		return err
+	}
+	if cls, mtd := mf.Identifier(); cls != clsID || mtd != mtdID {
+		return fmt.Errorf("expected %s, found method %d, %d", mf.MethodName(), clsID, mtdID)
+	}
+	return mf.Read(r)
+}
+
+func (s *Server) persistExchange(ex *exchange.Exchange) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(EXCHANGES_BUCKET)
+		if err != nil {
+			return err
+		}
+		encoded, err := encodeDeclare(&proto.ExchangeDeclare{
+			Exchange:  ex.Name,
+			Type:      exchange.ExTypeName(ex.ExType),
+			Durable:   ex.Durable,
+			Arguments: ex.Args,
+		})
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(ex.Name), encoded)
+	})
+}
+
+// depersistExchange removes the exchange along with
+// the bindings from and to the exchange
+func (s *Server) depersistExchange(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(EXCHANGES_BUCKET)
+		if err != nil {
+			return err
+		}
+		if err := bucket.Delete([]byte(name)); err != nil {
+			return err
+		}
+		return depersistBindingsWhere(tx, func(b *binding.Binding) bool {
+			return b.Exchange == name || b.DestExchange == name
+		})
+	})
+}
+
+func (s *Server) persistQueue(q *queue.Queue) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(QUEUES_BUCKET)
+		if err != nil {
+			return err
+		}
+		encoded, err := encodeDeclare(&proto.QueueDeclare{
+			Queue:      q.Name,
+			Durable:    q.Durable,
+			AutoDelete: q.AutoDelete,
+			Arguments:  q.Args,
+		})
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(q.Name), encoded)
+	})
+}
+
+// depersistQueue removes the queue along with the bindings to the queue
+func (s *Server) depersistQueue(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(QUEUES_BUCKET)
+		if err != nil {
+			return err
+		}
+		if err := bucket.Delete([]byte(name)); err != nil {
+			return err
+		}
+		return depersistBindingsWhere(tx, func(b *binding.Binding) bool {
+			return b.QueueName == name
+		})
+	})
+}
+
+func (s *Server) persistBinding(b *binding.Binding) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(BINDINGS_BUCKET)
+		if err != nil {
+			return err
+		}
+		encoded, err := b.Encode()
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(b.ID), encoded)
+	})
+}
+
+func (s *Server) depersistBinding(b *binding.Binding) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(BINDINGS_BUCKET)
+		if err != nil {
+			return err
+		}
+		return bucket.Delete([]byte(b.ID))
+	})
+}
+
+func depersistBindingsWhere(tx *bolt.Tx, match func(b *binding.Binding) bool) error {
+	bucket, err := tx.CreateBucketIfNotExists(BINDINGS_BUCKET)
+	if err != nil {
+		return err
+	}
+
+	keys := make([][]byte, 0)
+	err = bucket.ForEach(func(k, v []byte) error {
+		b, err := binding.Decode(v)
+		if err != nil {
+			return err
+		}
+		if match(b) {
+			keys = append(keys, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Keys are deleted after iterating, as bolt does not
+	// allow modifying a bucket while iterating over it
+	for _, k := range keys {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recoverDurables rebuilds the durable exchanges, queues and
+// bindings which were declared before the server restarted,
+// along with the persisted messages of the durable queues.
+// Bindings whose exchanges or queue are gone are dropped.
+func (s *Server) recoverDurables() error {
+	exchanges := make([]*proto.ExchangeDeclare, 0)
+	queues := make([]*proto.QueueDeclare, 0)
+	bindings := make([]*binding.Binding, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket(EXCHANGES_BUCKET); bucket != nil {
+			err := bucket.ForEach(func(k, v []byte) error {
+				ed := &proto.ExchangeDeclare{}
+				if err := decodeDeclare(v, ed); err != nil {
+					return fmt.Errorf("invalid exchange record %s: %s", k, err.Error())
+				}
+				exchanges = append(exchanges, ed)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if bucket := tx.Bucket(QUEUES_BUCKET); bucket != nil {
+			err := bucket.ForEach(func(k, v []byte) error {
+				qd := &proto.QueueDeclare{}
+				if err := decodeDeclare(v, qd); err != nil {
+					return fmt.Errorf("invalid queue record %s: %s", k, err.Error())
+				}
+				queues = append(queues, qd)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if bucket := tx.Bucket(BINDINGS_BUCKET); bucket != nil {
+			return bucket.ForEach(func(k, v []byte) error {
+				b, err := binding.Decode(v)
+				if err != nil {
+					return err
+				}
+				bindings = append(bindings, b)
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, ed := range exchanges {
+		ex, pErr := exchange.NewExchangeFromMethod(ed, s.exchangeDeleter)
+		if pErr != nil {
+			return pErr
+		}
+		if err := s.addExchange(ex); err != nil {
+			return err
+		}
+	}
+
+	for _, qd := range queues {
+		q := queue.NewQueue(qd.Queue, -1, s.queueDeleter, s.deadLetter, s.msgStore)
+		q.Durable = true
+		q.AutoDelete = qd.AutoDelete
+		if err := q.SetArguments(qd.Arguments); err != nil {
+			return err
+		}
+		if err := s.addQueue(q); err != nil {
+			return err
+		}
+
+		// Enqueue the persisted messages of the queue again
+		qms, err := s.msgStore.QueueMessages(q.Name)
+		if err != nil {
+			return err
+		}
+		for _, qm := range qms {
+			if err := q.Add(qm); err != nil {
+				s.msgStore.RemoveRef(qm, q.Name, nil)
+			}
+		}
+	}
+
+	for _, b := range bindings {
+		source, found := s.getExchange(b.Exchange)
+		if !found || !s.bindingDestinationExists(b) {
+			// Left behind by a server which stopped before removing it,
+			// or by a server.db edited by hand
+			fmt.Printf("Dropping persisted binding of %s to %s%s, not found\n", b.Exchange, b.QueueName, b.DestExchange)
+			if err := s.depersistBinding(b); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := source.AddBinding(b, -1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindingDestinationExists returns true if the queue or
+// exchange the binding routes to has been declared
+func (s *Server) bindingDestinationExists(b *binding.Binding) bool {
+	if b.ToExchange() {
+		_, found := s.getExchange(b.DestExchange)
+		return found
+	}
+	_, found := s.getQueue(b.QueueName)
+	return found
+}
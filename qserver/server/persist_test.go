@@ -0,0 +1,163 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/sauravgsh16/message-server/proto"
+	"github.com/sauravgsh16/message-server/qserver/binding"
+	"github.com/sauravgsh16/message-server/qserver/exchange"
+	"github.com/sauravgsh16/message-server/qserver/queue"
+	"github.com/sauravgsh16/message-server/qserver/store"
+)
+
+// newPersistServer returns a server on empty databases, and a
+// function which closes the databases and removes them
+func newPersistServer(t *testing.T) (*Server, func()) {
+	dir, err := ioutil.TempDir("", "persist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, "server.db"), 0666, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := restart(&Server{db: db})
+	msgStore, err := store.New(filepath.Join(dir, "messages.db"), s.isDurableQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.msgStore = msgStore
+
+	return s, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// restart returns a server on the databases of s, with nothing recovered yet
+func restart(s *Server) *Server {
+	r := &Server{
+		exchanges:       make(map[string]*exchange.Exchange),
+		queues:          make(map[string]*queue.Queue),
+		conns:           make(map[int64]*Connection),
+		exchangeDeleter: make(chan *exchange.Exchange),
+		queueDeleter:    make(chan *queue.Queue),
+		scheduled:       make(map[int64]*scheduledMessage),
+		db:              s.db,
+		msgStore:        s.msgStore,
+	}
+	r.initSystemExchanges()
+	return r
+}
+
+func TestRecoverDurables(t *testing.T) {
+	s, cleanup := newPersistServer(t)
+	defer cleanup()
+
+	ex := exchange.NewExchange("logs", exchange.EX_TOPIC, s.exchangeDeleter)
+	ex.Durable = true
+	if err := s.persistExchange(ex); err != nil {
+		t.Fatalf("persistExchange: %v", err)
+	}
+
+	q := queue.NewQueue("jobs", -1, s.queueDeleter, s.deadLetter, s.msgStore)
+	q.Durable = true
+	q.AutoDelete = true
+	args := proto.Table{queue.ArgMaxLength: int32(5)}
+	if err := q.SetArguments(args); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.persistQueue(q); err != nil {
+		t.Fatalf("persistQueue: %v", err)
+	}
+
+	mustBinding := func(b *binding.Binding, err error) *binding.Binding {
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	bindings := []*binding.Binding{
+		mustBinding(binding.NewBinding("jobs", "logs", "a.#", nil)),
+		mustBinding(binding.NewExchangeBinding("logs", "", "logs", nil)),
+		// Orphaned bindings, whose source or destination is gone
+		mustBinding(binding.NewBinding("jobs", "gone", "k", nil)),
+		mustBinding(binding.NewBinding("gone", "logs", "k", nil)),
+		mustBinding(binding.NewExchangeBinding("gone", "logs", "k", nil)),
+	}
+	for _, b := range bindings {
+		if err := s.persistBinding(b); err != nil {
+			t.Fatalf("persistBinding: %v", err)
+		}
+	}
+
+	r := restart(s)
+	if err := r.recoverDurables(); err != nil {
+		t.Fatalf("recoverDurables: %v", err)
+	}
+
+	rex, found := r.getExchange("logs")
+	if !found {
+		t.Fatal("exchange logs not recovered")
+	}
+	if rex.ExType != exchange.EX_TOPIC || !rex.Durable {
+		t.Errorf("exchange recovered with type %d, durable %v", rex.ExType, rex.Durable)
+	}
+	if n := rex.BindingCount(); n != 1 {
+		t.Errorf("exchange logs recovered with %d bindings, want 1", n)
+	}
+	// Along with the binding of every queue to the default exchange
+	if def, _ := r.getExchange(""); def.BindingCount() != 2 {
+		t.Errorf("default exchange recovered with %d bindings, want 2", def.BindingCount())
+	}
+
+	rq, found := r.getQueue("jobs")
+	if !found {
+		t.Fatal("queue jobs not recovered")
+	}
+	if !rq.Durable || !rq.AutoDelete || !rq.EqualArguments(args) {
+		t.Errorf("queue recovered as durable %v, auto-delete %v, arguments %v", rq.Durable, rq.AutoDelete, rq.Args)
+	}
+
+	// The orphaned bindings are removed from the database
+	var persisted int
+	s.db.View(func(tx *bolt.Tx) error {
+		persisted = tx.Bucket(BINDINGS_BUCKET).Stats().KeyN
+		return nil
+	})
+	if persisted != 2 {
+		t.Errorf("%d bindings persisted after recovery, want 2", persisted)
+	}
+
+	// Nothing orphaned is left for the next start
+	if err := restart(s).recoverDurables(); err != nil {
+		t.Fatalf("recoverDurables after dropping orphans: %v", err)
+	}
+}
+
+func TestDecodeDeclare(t *testing.T) {
+	encoded, err := encodeDeclare(&proto.QueueDeclare{Queue: "jobs", Durable: true})
+	if err != nil {
+		t.Fatalf("encodeDeclare: %v", err)
+	}
+
+	qd := &proto.QueueDeclare{}
+	if err := decodeDeclare(encoded, qd); err != nil {
+		t.Fatalf("decodeDeclare: %v", err)
+	}
+	if qd.Queue != "jobs" || !qd.Durable {
+		t.Errorf("decoded %+v", qd)
+	}
+
+	if err := decodeDeclare(encoded, &proto.ExchangeDeclare{}); err == nil {
+		t.Error("decoded a queue record as an exchange")
+	}
+	if err := decodeDeclare(encoded[:3], &proto.QueueDeclare{}); err == nil {
+		t.Error("decoded a truncated record")
+	}
+}
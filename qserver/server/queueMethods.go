@@ -3,6 +3,7 @@ package server
 import (
 	"fmt"
 
+	"github.com/sauravgsh16/message-server/allocate"
 	"github.com/sauravgsh16/message-server/proto"
 	"github.com/sauravgsh16/message-server/qserver/binding"
 	"github.com/sauravgsh16/message-server/qserver/queue"
@@ -23,6 +24,9 @@ func (ch *Channel) queueRoute(msgf proto.MessageFrame) *proto.Error {
 	case *proto.QueueDelete:
 		return ch.qDelete(m)
 
+	case *proto.QueuePurge:
+		return ch.qPurge(m)
+
 	default:
 		clsID, mtdID := msgf.Identifier()
 		return proto.NewHardError(540, "Not Implemented Queue method", clsID, mtdID)
@@ -32,22 +36,64 @@ func (ch *Channel) queueRoute(msgf proto.MessageFrame) *proto.Error {
 func (ch *Channel) qDeclare(m *proto.QueueDeclare) *proto.Error {
 	clsID, mtdID := m.Identifier()
 
+	if m.Passive {
+		return ch.qDeclarePassive(m)
+	}
+
+	// The server names the queue, if no name was given
+	if len(m.Queue) == 0 {
+		m.Queue = "gen-" + allocate.RandomID()
+	}
+
 	// Check if Queue already exists
 	q, found := ch.conn.server.getQueue(m.Queue)
 	if found {
-		qsize := uint32(q.Len())
-		csize := q.ConsumerCount()
-		ch.Send(&proto.QueueDeclareOk{
-			Queue:       m.Queue,
-			MessageCnt:  qsize,
-			ConsumerCnt: csize,
-		})
+		if q.ConnId != -1 && q.ConnId != ch.conn.id {
+			return proto.NewSoftError(405, "Queue is locked by another connection", clsID, mtdID)
+		}
+		if q.Durable != m.Durable {
+			return proto.NewSoftError(406, "Existing and new queue have different durability", clsID, mtdID)
+		}
+		if q.Exclusive != m.Exclusive {
+			return proto.NewSoftError(406, "Existing and new queue have different exclusivity", clsID, mtdID)
+		}
+		if q.AutoDelete != m.AutoDelete {
+			return proto.NewSoftError(406, "Existing and new queue have different auto-delete", clsID, mtdID)
+		}
+		if !q.EqualArguments(m.Arguments) {
+			return proto.NewSoftError(406, "Existing and new queue have different arguments", clsID, mtdID)
+		}
 		ch.usedQueueName = m.Queue
+		if !m.NoWait {
+			ch.Send(&proto.QueueDeclareOk{
+				Queue:       m.Queue,
+				MessageCnt:  uint32(q.Len()),
+				ConsumerCnt: q.ConsumerCount(),
+			})
+		}
 		return nil
 	}
 
-	// Create new Queue
-	q = queue.NewQueue(m.Queue, ch.conn.id, ch.server.queueDeleter, ch.server.msgStore)
+	// Create new Queue. Only exclusive queues are owned by the connection,
+	// and deleted along with it
+	connID := int64(-1)
+	if m.Exclusive {
+		connID = ch.conn.id
+	}
+	q = queue.NewQueue(m.Queue, connID, ch.server.queueDeleter, ch.server.deadLetter, ch.server.msgStore)
+	q.Durable = m.Durable
+	q.Exclusive = m.Exclusive
+	q.AutoDelete = m.AutoDelete
+	if err := q.SetArguments(m.Arguments); err != nil {
+		return proto.NewSoftError(406, err.Error(), clsID, mtdID)
+	}
+
+	if q.Persistent() {
+		if err := ch.server.persistQueue(q); err != nil {
+			return proto.NewSoftError(500, err.Error(), clsID, mtdID)
+		}
+	}
+
 	// Add Queue
 	err := ch.server.addQueue(q)
 	if err != nil {
@@ -64,6 +110,38 @@ func (ch *Channel) qDeclare(m *proto.QueueDeclare) *proto.Error {
 	return nil
 }
 
+// qDeclarePassive reports the message and consumer counts of an
+// existing queue. The queue is never created, or checked for its settings.
+func (ch *Channel) qDeclarePassive(m *proto.QueueDeclare) *proto.Error {
+	clsID, mtdID := m.Identifier()
+
+	if len(m.Queue) == 0 {
+		if len(ch.usedQueueName) == 0 {
+			return proto.NewSoftError(404, "Queue not found", clsID, mtdID)
+		}
+		m.Queue = ch.usedQueueName
+	}
+
+	q, found := ch.server.getQueue(m.Queue)
+	if !found || q.Closed {
+		return proto.NewSoftError(404, fmt.Sprintf("Queue: %s - not found", m.Queue), clsID, mtdID)
+	}
+
+	if q.ConnId != -1 && q.ConnId != ch.conn.id {
+		return proto.NewSoftError(405, "Queue is locked by another connection", clsID, mtdID)
+	}
+
+	ch.usedQueueName = m.Queue
+	if !m.NoWait {
+		ch.Send(&proto.QueueDeclareOk{
+			Queue:       m.Queue,
+			MessageCnt:  uint32(q.Len()),
+			ConsumerCnt: q.ConsumerCount(),
+		})
+	}
+	return nil
+}
+
 func (ch *Channel) qBind(m *proto.QueueBind) *proto.Error {
 	clsID, mtdID := m.Identifier()
 
@@ -90,12 +168,23 @@ func (ch *Channel) qBind(m *proto.QueueBind) *proto.Error {
 		return proto.NewSoftError(410, "Queue is binded to a different connection", clsID, mtdID)
 	}
 
+	if err := binding.CheckArguments(m.Arguments); err != nil {
+		return proto.NewSoftError(406, err.Error(), clsID, mtdID)
+	}
+
 	// Create binding
-	b, err := binding.NewBinding(m.Queue, m.Exchange, m.RoutingKey)
+	b, err := binding.NewBinding(m.Queue, m.Exchange, m.RoutingKey, m.Arguments)
 	if err != nil {
 		return proto.NewSoftError(500, err.Error(), clsID, mtdID)
 	}
 
+	// Bindings of durable queues to durable exchanges are durable
+	if ex.Durable && q.Persistent() {
+		if err := ch.server.persistBinding(b); err != nil {
+			return proto.NewSoftError(500, err.Error(), clsID, mtdID)
+		}
+	}
+
 	// Add the binding to the exchange
 	err = ex.AddBinding(b, ch.conn.id)
 	if err != nil {
@@ -134,11 +223,17 @@ func (ch *Channel) qUnbind(m *proto.QueueUnbind) *proto.Error {
 		return proto.NewSoftError(410, "Queue is binded to a different connection", clsID, mtdID)
 	}
 
-	binding, err := binding.NewBinding(m.Queue, m.Exchange, m.RoutingKey)
+	binding, err := binding.NewBinding(m.Queue, m.Exchange, m.RoutingKey, m.Arguments)
 	if err != nil {
 		return proto.NewSoftError(500, err.Error(), clsID, mtdID)
 	}
 
+	if ex.Durable && q.Persistent() {
+		if err := ch.server.depersistBinding(binding); err != nil {
+			return proto.NewSoftError(500, err.Error(), clsID, mtdID)
+		}
+	}
+
 	err = ex.RemoveBinding(binding)
 	if err != nil {
 		return proto.NewSoftError(500, err.Error(), clsID, mtdID)
@@ -168,3 +263,37 @@ func (ch *Channel) qDelete(m *proto.QueueDelete) *proto.Error {
 	}
 	return nil
 }
+
+func (ch *Channel) qPurge(m *proto.QueuePurge) *proto.Error {
+	clsID, mtdID := m.Identifier()
+
+	if len(m.Queue) == 0 {
+		if len(ch.usedQueueName) == 0 {
+			return proto.NewSoftError(404, "Queue not found", clsID, mtdID)
+		}
+		m.Queue = ch.usedQueueName
+	}
+
+	q, found := ch.server.getQueue(m.Queue)
+	if !found || q.Closed {
+		return proto.NewSoftError(404, fmt.Sprintf("Queue: %s - not found", m.Queue), clsID, mtdID)
+	}
+
+	if q.ConnId != -1 && q.ConnId != ch.conn.id {
+		return proto.NewSoftError(405, "Queue is locked by another connection", clsID, mtdID)
+	}
+
+	msgPurged, err := q.Purge()
+	switch {
+	case err == queue.ErrQueueClosed:
+		// Deleted since it was looked up
+		return proto.NewSoftError(404, fmt.Sprintf("Queue: %s - not found", m.Queue), clsID, mtdID)
+	case err != nil:
+		return proto.NewSoftError(500, err.Error(), clsID, mtdID)
+	}
+
+	if !m.NoWait {
+		ch.Send(&proto.QueuePurgeOk{MessageCnt: msgPurged})
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/sauravgsh16/message-server/proto"
+)
+
+var SCHEDULED_BUCKET = []byte("scheduled")
+
+// Message headers which delay the routing of a message
+const (
+	// xDelay is the delay in milliseconds
+	xDelay = "x-delay"
+	// xDeliverAt is the timestamp to route the message at
+	xDeliverAt = "x-deliver-at"
+)
+
+// scheduledMessage is a published message waiting to be routed
+type scheduledMessage struct {
+	msg       *proto.Message
+	deliverAt time.Time
+	timer     *time.Timer
+}
+
+// ScheduledMessage describes a message waiting to be routed, for inspection
+type ScheduledMessage struct {
+	ID         int64
+	Exchange   string
+	RoutingKey string
+	DeliverAt  time.Time
+}
+
+// deliverAt returns the time at which the message is to be routed,
+// given by its delay headers. It returns false if the message is not delayed.
+func deliverAt(msg *proto.Message) (time.Time, bool, error) {
+	if msg.Header == nil {
+		return time.Time{}, false, nil
+	}
+	headers := msg.Header.Properties.Headers
+
+	if v, found := headers[xDeliverAt]; found {
+		at, ok := v.(time.Time)
+		if !ok {
+			return time.Time{}, false, fmt.Errorf("invalid %s: expected timestamp, got %T", xDeliverAt, v)
+		}
+		return at, true, nil
+	}
+
+	v, found := headers[xDelay]
+	if !found {
+		return time.Time{}, false, nil
+	}
+	delay, ok := proto.IntValue(v)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("invalid %s: expected integer, got %T", xDelay, v)
+	}
+	if delay <= 0 {
+		return time.Time{}, false, nil
+	}
+	return time.Now().Add(time.Duration(delay) * time.Millisecond), true, nil
+}
+
+// scheduleKey orders the scheduled messages in the bucket by the time they are routed at
+func scheduleKey(sm *scheduledMessage) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, 16))
+	binary.Write(buf, binary.BigEndian, sm.deliverAt.UnixNano())
+	binary.Write(buf, binary.BigEndian, sm.msg.ID)
+	return buf.Bytes()
+}
+
+// schedule persists the message, and routes it through its exchange once
+// it is time. The message is held durably till then, whatever its delivery mode.
+func (s *Server) schedule(msg *proto.Message, at time.Time) error {
+	sm := &scheduledMessage{
+		msg:       msg,
+		deliverAt: at,
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(SCHEDULED_BUCKET)
+		if err != nil {
+			return err
+		}
+		encoded, err := msg.Encode()
+		if err != nil {
+			return err
+		}
+		return bucket.Put(scheduleKey(sm), encoded)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.addScheduled(sm)
+	return nil
+}
+
+func (s *Server) addScheduled(sm *scheduledMessage) {
+	s.scheduleMux.Lock()
+	defer s.scheduleMux.Unlock()
+
+	s.scheduled[sm.msg.ID] = sm
+	sm.timer = time.AfterFunc(time.Until(sm.deliverAt), func() {
+		s.routeScheduled(sm.msg.ID)
+	})
+}
+
+// Scheduled returns the messages waiting to be routed, in the order they are routed
+func (s *Server) Scheduled() []ScheduledMessage {
+	s.scheduleMux.Lock()
+	scheduled := make([]ScheduledMessage, 0, len(s.scheduled))
+	for _, sm := range s.scheduled {
+		scheduled = append(scheduled, ScheduledMessage{
+			ID:         sm.msg.ID,
+			Exchange:   sm.msg.Exchange,
+			RoutingKey: sm.msg.RoutingKey,
+			DeliverAt:  sm.deliverAt,
+		})
+	}
+	s.scheduleMux.Unlock()
+
+	sort.Slice(scheduled, func(i, j int) bool {
+		if scheduled[i].DeliverAt.Equal(scheduled[j].DeliverAt) {
+			return scheduled[i].ID < scheduled[j].ID
+		}
+		return scheduled[i].DeliverAt.Before(scheduled[j].DeliverAt)
+	})
+	return scheduled
+}
+
+// scheduledCount returns the number of messages waiting to be routed through the exchange
+func (s *Server) scheduledCount(exchange string) uint32 {
+	var count uint32
+	for _, sm := range s.Scheduled() {
+		if sm.Exchange == exchange {
+			count++
+		}
+	}
+	return count
+}
+
+// routeScheduled publishes the scheduled message to its exchange. Messages
+// are removed from the bucket once the message store has persisted them.
+// Scheduled messages whose exchange has been deleted are dropped.
+func (s *Server) routeScheduled(id int64) {
+	s.scheduleMux.Lock()
+	sm, found := s.scheduled[id]
+	delete(s.scheduled, id)
+	s.scheduleMux.Unlock()
+
+	if !found {
+		return
+	}
+
+	if ex, found := s.getExchange(sm.msg.Exchange); found {
+		// There is no publisher to return unroutable messages to
+		s.publish(ex, sm.msg)
+		<-s.msgStore.Persisted()
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(SCHEDULED_BUCKET)
+		if err != nil {
+			return err
+		}
+		return bucket.Delete(scheduleKey(sm))
+	})
+	if err != nil {
+		fmt.Printf("Failed to remove scheduled message %d: %s\n", id, err.Error())
+	}
+}
+
+// recoverScheduled schedules the messages which were waiting to be routed
+// before the server restarted. Overdue messages are routed right away.
+func (s *Server) recoverScheduled() error {
+	scheduled := make([]*scheduledMessage, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(SCHEDULED_BUCKET)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			msg, err := proto.DecodeMessage(v)
+			if err != nil {
+				return err
+			}
+			var at int64
+			if err := binary.Read(bytes.NewReader(k), binary.BigEndian, &at); err != nil {
+				return err
+			}
+			scheduled = append(scheduled, &scheduledMessage{
+				msg:       msg,
+				deliverAt: time.Unix(0, at),
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, sm := range scheduled {
+		s.addScheduled(sm)
+	}
+	return nil
+}
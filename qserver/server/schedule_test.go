@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/sauravgsh16/message-server/proto"
+)
+
+// delayedMessage returns a message with the headers, or without a header frame for nil
+func delayedMessage(headers proto.Table) *proto.Message {
+	msg := proto.NewMessage(&proto.BasicPublish{Exchange: "ex", RoutingKey: "key"})
+	if headers != nil {
+		msg.Header = &proto.HeaderFrame{Properties: proto.Properties{Headers: headers}}
+	}
+	return msg
+}
+
+func TestDeliverAt(t *testing.T) {
+	at := time.Unix(1900000000, 0)
+
+	tests := []struct {
+		name        string
+		headers     proto.Table
+		wantDelayed bool
+		wantAt      time.Time
+		wantErr     bool
+	}{
+		{"no header frame", nil, false, time.Time{}, false},
+		{"no delay headers", proto.Table{"app": "billing"}, false, time.Time{}, false},
+		{"deliver at", proto.Table{xDeliverAt: at}, true, at, false},
+		{"deliver at in the past", proto.Table{xDeliverAt: time.Unix(1, 0)}, true, time.Unix(1, 0), false},
+		{"deliver at not a timestamp", proto.Table{xDeliverAt: "tomorrow"}, false, time.Time{}, true},
+		{"deliver at wins over delay", proto.Table{xDeliverAt: at, xDelay: int32(5000)}, true, at, false},
+		{"delay zero", proto.Table{xDelay: int32(0)}, false, time.Time{}, false},
+		{"delay negative", proto.Table{xDelay: int64(-10)}, false, time.Time{}, false},
+		{"delay not an integer", proto.Table{xDelay: "5000"}, false, time.Time{}, true},
+		{"delay float", proto.Table{xDelay: float64(5000)}, false, time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, delayed, err := deliverAt(delayedMessage(tt.headers))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("deliverAt() error = %v, want error %v", err, tt.wantErr)
+			}
+			if delayed != tt.wantDelayed {
+				t.Fatalf("deliverAt() delayed = %v, want %v", delayed, tt.wantDelayed)
+			}
+			if !got.Equal(tt.wantAt) {
+				t.Errorf("deliverAt() = %v, want %v", got, tt.wantAt)
+			}
+		})
+	}
+}
+
+func TestDeliverAtDelay(t *testing.T) {
+	// Delays of every integer size are in milliseconds from now
+	for _, delay := range []interface{}{int8(100), uint16(1000), int32(5000), int64(60000)} {
+		ms, _ := proto.IntValue(delay)
+		want := time.Duration(ms) * time.Millisecond
+
+		before := time.Now()
+		got, delayed, err := deliverAt(delayedMessage(proto.Table{xDelay: delay}))
+		after := time.Now()
+
+		if err != nil || !delayed {
+			t.Fatalf("deliverAt() with delay %T %v = %v, %v, want delayed", delay, delay, delayed, err)
+		}
+		if got.Before(before.Add(want)) || got.After(after.Add(want)) {
+			t.Errorf("deliverAt() with delay %v = %v, want %v from now", delay, got, want)
+		}
+	}
+}
+
+func TestScheduleKeyOrder(t *testing.T) {
+	at := time.Unix(1900000000, 0)
+	first := &scheduledMessage{msg: &proto.Message{ID: 9}, deliverAt: at}
+	sameTime := &scheduledMessage{msg: &proto.Message{ID: 10}, deliverAt: at}
+	later := &scheduledMessage{msg: &proto.Message{ID: 1}, deliverAt: at.Add(time.Millisecond)}
+
+	// Keys sort by the time messages are routed at, then by message id
+	if bytes.Compare(scheduleKey(first), scheduleKey(sameTime)) >= 0 {
+		t.Error("key of the lower id at the same time does not sort first")
+	}
+	if bytes.Compare(scheduleKey(sameTime), scheduleKey(later)) >= 0 {
+		t.Error("key of the earlier time does not sort first")
+	}
+}
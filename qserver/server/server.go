@@ -14,6 +14,16 @@ import (
 	"github.com/sauravgsh16/message-server/qserver/store"
 )
 
+// Reply codes of returned messages
+const (
+	// replyQueueFull is used when a queue the message was routed to was at its length limits
+	replyQueueFull uint16 = 311
+	// replyNoRoute is used when a mandatory message could not be routed to any queue
+	replyNoRoute uint16 = 312
+	// replyNoConsumers is used when an immediate message could not be consumed right away
+	replyNoConsumers uint16 = 313
+)
+
 // Server struct
 type Server struct {
 	exchanges       map[string]*exchange.Exchange
@@ -24,6 +34,8 @@ type Server struct {
 	msgStore        *store.MsgStore
 	exchangeDeleter chan *exchange.Exchange
 	queueDeleter    chan *queue.Queue
+	scheduled       map[int64]*scheduledMessage
+	scheduleMux     sync.Mutex
 }
 
 // TODO: INCASE - THE SERVER AND THE MESSAGE DB NEEDS TO BE SEPARATE - THIS IS THE POINT WHERE WE ACCEPT TWO DIFFERENT DB PATHS.
@@ -34,23 +46,34 @@ func NewServer(dbFilePath, msgStoreFilePath string) *Server {
 	if err != nil {
 		panic(err.Error())
 	}
-	msgStore, err := store.New(msgStoreFilePath)
-	if err != nil {
-		panic("unable to create message store")
-	}
-	msgStore.Start()
 	var s = &Server{
 		exchanges:       make(map[string]*exchange.Exchange),
 		queues:          make(map[string]*queue.Queue),
 		conns:           make(map[int64]*Connection),
 		exchangeDeleter: make(chan *exchange.Exchange),
 		queueDeleter:    make(chan *queue.Queue),
+		scheduled:       make(map[int64]*scheduledMessage),
 		db:              db,
-		msgStore:        msgStore,
 	}
+	msgStore, err := store.New(msgStoreFilePath, s.isDurableQueue)
+	if err != nil {
+		panic("unable to create message store")
+	}
+	if err := msgStore.Recover(); err != nil {
+		panic("unable to recover persisted messages: " + err.Error())
+	}
+	msgStore.Start()
+	s.msgStore = msgStore
 
 	s.initSystemExchanges()
 
+	if err := s.recoverDurables(); err != nil {
+		panic("unable to recover durable exchanges and queues: " + err.Error())
+	}
+	if err := s.recoverScheduled(); err != nil {
+		panic("unable to recover scheduled messages: " + err.Error())
+	}
+
 	s.monitorExDelete()
 	s.monitorQDelete()
 	return s
@@ -59,7 +82,9 @@ func NewServer(dbFilePath, msgStoreFilePath string) *Server {
 // OpenConnection starts the process of opening a tcp connection
 func (s *Server) OpenConnection(conn net.Conn) {
 	c := NewConnection(s, conn)
+	s.mux.Lock()
 	s.conns[c.id] = c
+	s.mux.Unlock()
 	c.openConnection()
 }
 
@@ -82,8 +107,9 @@ func (s *Server) registerDefaultExchange(name string, extype uint8) {
 			extype,
 			s.exchangeDeleter,
 		)
-		// TODO
-		// PERSIST DB -- WHEN DB IS IMPLEMENTED
+		// System exchanges are declared on every start,
+		// hence they are durable without being persisted
+		ex.Durable = true
 		s.addExchange(ex)
 	}
 }
@@ -108,7 +134,7 @@ func (s *Server) monitorQDelete() {
 				Queue:  q.Name,
 				NoWait: true,
 			}
-			s.deleteQueue(qDel, -1)
+			s.deleteQueue(qDel, q.ConnId)
 		}
 	}()
 }
@@ -139,9 +165,20 @@ func (s *Server) deleteExchange(m *proto.ExchangeDelete) (uint16, error) {
 
 	// TODO: check if exchange is being used
 
+	if ex.Durable {
+		if err := s.depersistExchange(m.Exchange); err != nil {
+			return 500, err
+		}
+	}
+
 	// Close everything associated with the exchange
 	ex.Close()
 	delete(s.exchanges, m.Exchange)
+
+	// Remove bindings of other exchanges to the deleted exchange
+	for _, source := range s.exchanges {
+		source.RemoveExchangeBindings(m.Exchange)
+	}
 	return 0, nil
 }
 
@@ -152,7 +189,7 @@ func (s *Server) addQueue(q *queue.Queue) error {
 
 	// Create new binding and register default exchange to it.
 	defaultEx := s.exchanges[""]
-	defaultBind, err := binding.NewBinding(q.Name, "", q.Name)
+	defaultBind, err := binding.NewBinding(q.Name, "", q.Name, nil)
 	if err != nil {
 		return err
 	}
@@ -163,6 +200,11 @@ func (s *Server) addQueue(q *queue.Queue) error {
 	return nil
 }
 
+func (s *Server) isDurableQueue(name string) bool {
+	q, found := s.getQueue(name)
+	return found && q.Persistent()
+}
+
 func (s *Server) getQueue(name string) (*queue.Queue, bool) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
@@ -184,6 +226,12 @@ func (s *Server) deleteQueue(m *proto.QueueDelete, connID int64) (uint32, uint16
 		return 0, 405, fmt.Errorf("Queue is locked by another connection")
 	}
 
+	if q.Persistent() {
+		if err := s.depersistQueue(m.Queue); err != nil {
+			return 0, 500, err
+		}
+	}
+
 	// Close queue - to stop any data enqueue and dequeue
 	q.Close()
 	// Remove queue from all the bindings
@@ -205,6 +253,9 @@ func (s *Server) removeQueueBindings(qName string) {
 }
 
 func (s *Server) deleteConnection(connID int64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
 	delete(s.conns, connID)
 }
 
@@ -235,19 +286,28 @@ func (s *Server) basicReturnMsg(msg *proto.Message, code uint16, text string) *p
 	}
 }
 
+// publish routes the message to its queues. Unroutable messages are only returned if they are mandatory.
 func (s *Server) publish(ex *exchange.Exchange, msg *proto.Message) (*proto.BasicReturn, *proto.Error) {
+	mandatory := msg.Method.(*proto.BasicPublish).Mandatory
+
 	if ex.Closed {
-		return s.basicReturnMsg(msg, 313, "Exchange closed, unable to route message"), nil // AGAIN CHECK FOR RETURN CODE - IMPLEMENT CONSTANT
+		if !mandatory {
+			return nil, nil
+		}
+		return s.basicReturnMsg(msg, replyNoRoute, "Exchange closed, unable to route message"), nil
 	}
 
-	queues, err := ex.QueuesToPublish(msg)
+	queues, err := ex.QueuesToPublish(msg, s.getExchange)
 	if err != nil {
 		return nil, err
 	}
 
 	// No avaliable queues
 	if len(queues) == 0 {
-		return s.basicReturnMsg(msg, 313, "No available queues found"), nil
+		if !mandatory {
+			return nil, nil
+		}
+		return s.basicReturnMsg(msg, replyNoRoute, "No available queues found"), nil
 	}
 
 	// Add message and queue to message store.
@@ -261,7 +321,9 @@ func (s *Server) publish(ex *exchange.Exchange, msg *proto.Message) (*proto.Basi
 		return s.consumeMsgImmediate(msg, queues, qQueueMsgMap)
 	}
 
-	s.addMsgForConsumption(msg, queues, qQueueMsgMap)
+	if s.addMsgForConsumption(msg, queues, qQueueMsgMap) {
+		return s.basicReturnMsg(msg, replyQueueFull, "Queue length limit reached, message rejected"), nil
+	}
 	return nil, nil
 }
 
@@ -284,22 +346,46 @@ func (s *Server) consumeMsgImmediate(msg *proto.Message, queues []string, qmMap
 		}
 	}
 	if !consumed {
-		return s.basicReturnMsg(msg, 313, "No consumers available"), nil
+		return s.basicReturnMsg(msg, replyNoConsumers, "No consumers available"), nil
 	}
 	return nil, nil
 }
 
-func (s *Server) addMsgForConsumption(msg *proto.Message, queues []string, qmMap map[string][]*proto.QueueMessage) {
+// addMsgForConsumption adds the message to the queues it was routed to.
+// It returns true if any of the queues rejected the message.
+func (s *Server) addMsgForConsumption(msg *proto.Message, queues []string, qmMap map[string][]*proto.QueueMessage) bool {
+	rejected := false
 	for _, queueName := range queues {
 		qMsgs := qmMap[queueName]
 		for _, qm := range qMsgs {
-			q, found := s.queues[queueName]
-			if !found || !q.Add(qm) {
-				// Need to remove queue reference from msg store
-				// particularly queue message
-				mrh := make([]proto.MessageResourceHolder, 0)
-				s.msgStore.RemoveRef(qm, queueName, mrh)
+			if s.enqueue(queueName, qm) {
+				rejected = true
 			}
 		}
 	}
+	return rejected
+}
+
+// enqueue adds the queue message to the queue. Messages the queue does not take
+// are removed from the message store. No resources are released for them, as
+// published messages hold no channel resources. It returns true if the queue
+// rejected the message because of its length limits.
+func (s *Server) enqueue(queueName string, qm *proto.QueueMessage) bool {
+	mrh := make([]proto.MessageResourceHolder, 0)
+	q, found := s.getQueue(queueName)
+	if !found {
+		// Queue could have been deleted
+		s.msgStore.RemoveRef(qm, queueName, mrh)
+		return false
+	}
+
+	err := q.Add(qm)
+	if err == nil {
+		return false
+	}
+	if err == queue.ErrQueueFull && q.Overflow == queue.OverflowRejectPublishDLX {
+		s.deadLetter(q, qm, queue.DeadLetterMaxLen)
+	}
+	s.msgStore.RemoveRef(qm, queueName, mrh)
+	return err == queue.ErrQueueFull
 }
@@ -23,6 +23,10 @@ func (ch *Channel) txRoute(msgf proto.MessageFrame) *proto.Error {
 }
 
 func (ch *Channel) txSelect(m *proto.TxSelect) *proto.Error {
+	if ch.confirmMode {
+		clsID, mtdID := m.Identifier()
+		return proto.NewSoftError(406, "Channel in confirm mode, cannot select transaction mode", clsID, mtdID)
+	}
 	ch.startTxMode()
 	ch.Send(&proto.TxSelectOk{})
 	return nil
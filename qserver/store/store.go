@@ -5,7 +5,6 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"os"
 	"sync"
 	"time"
 
@@ -23,6 +22,7 @@ type Key struct {
 
 type MsgStore struct {
 	db          *bolt.DB
+	durable     func(queueName string) bool
 	index       map[int64]*proto.IndexMessage
 	messages    map[int64]*proto.Message
 	qmToAdd     map[Key]*proto.QueueMessage
@@ -31,22 +31,12 @@ type MsgStore struct {
 	indexMux    sync.RWMutex
 	msgMux      sync.RWMutex
 	persistMux  sync.Mutex
+	persisted   chan struct{}
 }
 
-func deleteFileIfPresent(filePath string) {
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return
-	}
-	if err := os.Remove(filePath); err != nil {
-		panic("Failed to remove old DB file")
-	}
-}
-
-func New(filePath string) (*MsgStore, error) {
-	// Check if file name already present -
-	// remove it for new session to start
-	deleteFileIfPresent(filePath)
-
+// New returns a message store backed by the DB at filePath.
+// Persistent messages are persisted when routed to a queue for which durable returns true.
+func New(filePath string, durable func(queueName string) bool) (*MsgStore, error) {
 	db, err := bolt.Open(filePath, 0666, nil)
 	if err != nil {
 		return nil, err
@@ -54,11 +44,13 @@ func New(filePath string) (*MsgStore, error) {
 
 	return &MsgStore{
 		db:          db,
+		durable:     durable,
 		index:       make(map[int64]*proto.IndexMessage),
 		messages:    make(map[int64]*proto.Message),
 		qmToAdd:     make(map[Key]*proto.QueueMessage),
 		qmToDelete:  make(map[Key]*proto.QueueMessage),
 		qmDelivered: make(map[Key]*proto.QueueMessage),
+		persisted:   make(chan struct{}),
 	}, nil
 }
 
@@ -78,6 +70,8 @@ func (ms *MsgStore) AddTxMessages(msgs []*proto.TxMessage) (map[string][]*proto.
 	// Create IndexMessage instances for each message
 	idxMsg := make(map[int64]*proto.IndexMessage)
 	qMsg := make(map[string][]*proto.QueueMessage)
+	toPersist := make(map[Key]*proto.QueueMessage)
+	now := time.Now()
 
 	for _, msg := range msgs {
 		// Check or Create index message
@@ -98,7 +92,29 @@ func (ms *MsgStore) AddTxMessages(msgs []*proto.TxMessage) (map[string][]*proto.
 			0,
 			calcMessageSize(msg.Msg),
 		)
+		qm.EnqueuedAt = now.UnixNano()
+		if ttl, ok, err := msg.Msg.TTL(); err == nil && ok {
+			qm.ExpiresAt = now.Add(ttl).UnixNano()
+		}
+		if msg.Msg.Header != nil {
+			qm.Priority = msg.Msg.Header.Properties.Priority
+		}
 		qMsg[msg.QueueName] = append(queues, qm)
+
+		// Persistent messages are only persisted for durable queues
+		if msg.Msg.Persistent() && ms.durable(msg.QueueName) {
+			qm.Persisted = true
+			im.Persisted = true
+			toPersist[Key{id: qm.ID, queuename: msg.QueueName}] = qm
+		}
+	}
+
+	if len(toPersist) > 0 {
+		ms.persistMux.Lock()
+		for k, qm := range toPersist {
+			ms.qmToAdd[k] = qm
+		}
+		ms.persistMux.Unlock()
 	}
 
 	// Add indexes and messages to Memory
@@ -152,12 +168,46 @@ func (ms *MsgStore) RemoveRef(qm *proto.QueueMessage, queueName string, mrh []pr
 		ms.indexMux.Unlock()
 	}
 
+	if qm.Persisted {
+		ms.persistMux.Lock()
+		ms.qmToDelete[Key{id: qm.ID, queuename: queueName}] = qm
+		ms.persistMux.Unlock()
+	}
+
 	for _, rh := range mrh {
 		rh.ReleaseResources(qm)
 	}
 	return nil
 }
 
+// IncrDeliveryCount marks the queue message as delivered once more
+func (ms *MsgStore) IncrDeliveryCount(qm *proto.QueueMessage, queueName string) {
+	im, found := ms.GetIdxMsg(qm.ID)
+	if !found {
+		panic("Message in queue - but not in Index. Unrecoverable failure")
+	}
+
+	qm.DeliveryCount++
+	im.DeliveryCount++
+
+	if !qm.Persisted {
+		return
+	}
+
+	ms.persistMux.Lock()
+	ms.qmDelivered[Key{id: qm.ID, queuename: queueName}] = qm
+	ms.persistMux.Unlock()
+}
+
+// Persisted returns a channel which is closed once all the changes
+// made to the store so far have been committed to the DB
+func (ms *MsgStore) Persisted() <-chan struct{} {
+	ms.persistMux.Lock()
+	defer ms.persistMux.Unlock()
+
+	return ms.persisted
+}
+
 func (ms *MsgStore) Get(qm *proto.QueueMessage, mrh []proto.MessageResourceHolder) (*proto.Message, bool) {
 	ms.msgMux.Lock()
 	defer ms.msgMux.Unlock()
@@ -201,6 +251,7 @@ func (ms *MsgStore) resetOps() {
 	ms.qmToAdd = make(map[Key]*proto.QueueMessage)
 	ms.qmToDelete = make(map[Key]*proto.QueueMessage)
 	ms.qmDelivered = make(map[Key]*proto.QueueMessage)
+	ms.persisted = make(chan struct{})
 }
 
 func (ms *MsgStore) persistDB() {
@@ -208,6 +259,7 @@ func (ms *MsgStore) persistDB() {
 	qmToAdd := ms.qmToAdd
 	qmToDelete := ms.qmToDelete
 	qmDelivered := ms.qmDelivered
+	persisted := ms.persisted
 	ms.resetOps()
 	ms.persistMux.Unlock()
 
@@ -229,33 +281,34 @@ func (ms *MsgStore) persistDB() {
 	if err := ms.db.Update(uf); err != nil {
 		panic("Failed to persist data: " + err.Error())
 	}
+
+	// Notify everyone waiting on this set of changes
+	close(persisted)
 }
 
 func (ms *MsgStore) updateFunc(qmToAdd, qmToDelete, qmDelivered map[Key]*proto.QueueMessage) func(tx *bolt.Tx) error {
 	return func(tx *bolt.Tx) error {
 		// Add functionality
-		alreadyAdded := make(map[int64]bool)
 		for k, qm := range qmToAdd {
+			msg, found := ms.GetMsg(k.id)
+			if !found {
+				// This means, msg must have been deleted earlier
+				continue
+			}
 			// Add messages to content/index stores
-			if _, ok := alreadyAdded[k.id]; !ok {
-				msg, foundMsg := ms.GetMsg(k.id)
-				im, foundIm := ms.GetIdxMsg(k.id)
-				if foundMsg != foundIm {
-					panic("Message index discrepency")
-				}
-				if !foundMsg {
-					// This means, msg must have been deleted earlier
-					continue
-				}
-				persistMsg(tx, msg)
-				persistIdxMsg(tx, im)
+			if err := incrementIdxRef(tx, msg); err != nil {
+				return err
+			}
+			if err := persistQMsg(tx, k.queuename, qm); err != nil {
+				return err
 			}
-			persistQMsg(tx, k.queuename, qm)
 		}
 
 		// Update delivered
 		for k, qm := range qmDelivered {
-			persistQMsg(tx, k.queuename, qm)
+			if err := persistQMsg(tx, k.queuename, qm); err != nil {
+				return err
+			}
 		}
 
 		// Delete qm - remove from queue
@@ -263,7 +316,7 @@ func (ms *MsgStore) updateFunc(qmToAdd, qmToDelete, qmDelivered map[Key]*proto.Q
 			if err := depersistQMsg(tx, k.queuename, qm.ID); err != nil {
 				return err
 			}
-			refCount, err := decrementIdxRef(tx, qm.ID, ms)
+			refCount, err := decrementIdxRef(tx, qm.ID)
 			if err != nil {
 				return err
 			}
@@ -281,7 +334,8 @@ func (ms *MsgStore) updateFunc(qmToAdd, qmToDelete, qmDelivered map[Key]*proto.Q
 
 func getIdByte(id int64) []byte {
 	buf := bytes.NewBuffer(make([]byte, 0, 8))
-	binary.Write(buf, binary.LittleEndian, id)
+	// Big endian keys keep the messages of a queue bucket in publish order
+	binary.Write(buf, binary.BigEndian, id)
 	return buf.Bytes()
 }
 
@@ -290,7 +344,7 @@ func persistMsg(tx *bolt.Tx, msg *proto.Message) error {
 	if err != nil {
 		return err
 	}
-	encoded, err := json.Marshal(msg)
+	encoded, err := msg.Encode()
 	if err != nil {
 		return err
 	}
@@ -299,7 +353,7 @@ func persistMsg(tx *bolt.Tx, msg *proto.Message) error {
 }
 
 func persistIdxMsg(tx *bolt.Tx, im *proto.IndexMessage) error {
-	bucket, err := tx.CreateBucketIfNotExists(CONTENT_BUCKET)
+	bucket, err := tx.CreateBucketIfNotExists(INDEX_BUCKET)
 	if err != nil {
 		return err
 	}
@@ -344,7 +398,32 @@ func depersistQMsg(tx *bolt.Tx, qname string, id int64) error {
 	return bucket.Delete(key)
 }
 
-func decrementIdxRef(tx *bolt.Tx, id int64, ms *MsgStore) (int32, error) {
+// incrementIdxRef adds a reference to the persisted index message,
+// persisting the message content along with its first reference
+func incrementIdxRef(tx *bolt.Tx, msg *proto.Message) error {
+	bucket, err := tx.CreateBucketIfNotExists(INDEX_BUCKET)
+	if err != nil {
+		return err
+	}
+
+	im := proto.NewIndexMessage(msg.ID, 0, 0)
+	im.Persisted = true
+
+	if dataBytes := bucket.Get(getIdByte(msg.ID)); dataBytes != nil {
+		if err := json.Unmarshal(dataBytes, im); err != nil {
+			return err
+		}
+	} else if err := persistMsg(tx, msg); err != nil {
+		return err
+	}
+
+	im.Refs += 1
+	return persistIdxMsg(tx, im)
+}
+
+// decrementIdxRef removes a reference from the persisted index message.
+// The persisted index only counts the references of durable queues.
+func decrementIdxRef(tx *bolt.Tx, id int64) (int32, error) {
 	bucket, err := tx.CreateBucketIfNotExists(INDEX_BUCKET)
 	if err != nil {
 		return -1, err
@@ -354,6 +433,9 @@ func decrementIdxRef(tx *bolt.Tx, id int64, ms *MsgStore) (int32, error) {
 
 	key := getIdByte(id)
 	dataBytes := bucket.Get(key)
+	if dataBytes == nil {
+		return 0, nil
+	}
 
 	err = json.Unmarshal(dataBytes, im)
 	if err != nil {
@@ -366,15 +448,7 @@ func decrementIdxRef(tx *bolt.Tx, id int64, ms *MsgStore) (int32, error) {
 
 	im.Refs -= 1
 	if im.Refs == 0 {
-		// Reference count Zero - delete ref from messages and Index.
-		// Remove key from bucket
-		ms.msgMux.Lock()
-		delete(ms.messages, id)
-		ms.msgMux.Unlock()
-
-		ms.indexMux.Lock()
-		delete(ms.index, id)
-		ms.indexMux.Unlock()
+		// Reference count Zero - remove key from bucket
 		return 0, bucket.Delete(key)
 	}
 
@@ -384,3 +458,66 @@ func decrementIdxRef(tx *bolt.Tx, id int64, ms *MsgStore) (int32, error) {
 	}
 	return im.Refs, bucket.Put(key, freshEncodedBytes)
 }
+
+// Recover loads the persisted messages and their index into memory
+func (ms *MsgStore) Recover() error {
+	return ms.db.View(func(tx *bolt.Tx) error {
+		ms.msgMux.Lock()
+		defer ms.msgMux.Unlock()
+		ms.indexMux.Lock()
+		defer ms.indexMux.Unlock()
+
+		if bucket := tx.Bucket(INDEX_BUCKET); bucket != nil {
+			err := bucket.ForEach(func(k, v []byte) error {
+				im := &proto.IndexMessage{}
+				if err := json.Unmarshal(v, im); err != nil {
+					return err
+				}
+				ms.index[im.ID] = im
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if bucket := tx.Bucket(CONTENT_BUCKET); bucket != nil {
+			return bucket.ForEach(func(k, v []byte) error {
+				msg, err := proto.DecodeMessage(v)
+				if err != nil {
+					return err
+				}
+				ms.messages[msg.ID] = msg
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+// QueueMessages returns the persisted messages of the queue in publish order
+func (ms *MsgStore) QueueMessages(queueName string) ([]*proto.QueueMessage, error) {
+	qms := make([]*proto.QueueMessage, 0)
+
+	err := ms.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(fmt.Sprintf("queue_%s", queueName)))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			qm := &proto.QueueMessage{}
+			if err := json.Unmarshal(v, qm); err != nil {
+				return err
+			}
+			if _, found := ms.GetMsg(qm.ID); !found {
+				return fmt.Errorf("message %d of queue %s not found", qm.ID, queueName)
+			}
+			qms = append(qms, qm)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return qms, nil
+}
@@ -26,7 +26,9 @@ func main() {
 	err = ch.ExchangeDeclare(
 		"test",   // name
 		"fanout", // type
+		false,    // durable
 		false,    // noWait
+		nil,      // arguments
 	)
 	failOnError(err, "Failed to declare exchange")
 
@@ -36,6 +38,7 @@ func main() {
 		err = ch.Publish(
 			"test", // name
 			"",     // routing key
+			false,  // mandatory
 			false,  // immediate
 			qclient.MetaDataWithBody{
 				ContentType:   "text/plain",
@@ -55,6 +58,7 @@ func main() {
 		ch.Publish(
 			"test", // name
 			"",     // routing key
+			false,  // mandatory
 			false,  // immediate
 			qclient.MetaDataWithBody{
 				ContentType:   "text/plain",
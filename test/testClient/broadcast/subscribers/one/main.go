@@ -26,12 +26,18 @@ func main() {
 	err = ch.ExchangeDeclare(
 		"test",   // name
 		"fanout", // type
+		false,    // durable
 		false,    // noWait
+		nil,      // arguments
 	)
 
 	q, err := ch.QueueDeclare(
 		"qtest1", // name
+		false,    // durable
+		false,    // autoDelete
+		false,    // exclusive
 		false,    // noWait
+		nil,      // arguments
 	)
 
 	err = ch.QueueBind(
@@ -39,6 +45,7 @@ func main() {
 		"test",  // exhange name
 		"",      // routing key
 		false,   // noWait
+		nil,     // arguments
 	)
 
 	msgs, err := ch.Consume(
@@ -46,6 +53,7 @@ func main() {
 		"c1",    // Consumer Name
 		true,    // noAck
 		false,   // noWait
+		nil,     // arguments
 	)
 	failOnError(err, "Failed to register a consumer")
 
@@ -28,7 +28,9 @@ func main() {
 	err = ch.ExchangeDeclare(
 		"test",   // name
 		"fanout", // type
+		false,    // durable
 		false,    // noWait
+		nil,      // arguments
 	)
 	failOnError(err, "Failed to declare exchange")
 
@@ -42,6 +44,7 @@ func main() {
 			err = ch.Publish(
 				"test", // name
 				"",     // routing key
+				false,  // mandatory
 				false,  // immediate
 				qclient.MetaDataWithBody{
 					ContentType:   "text/plain",
@@ -25,7 +25,11 @@ func main() {
 
 	q, err := ch.QueueDeclare(
 		"hello", // name
+		false,   // durable
+		false,   // autoDelete
+		false,   // exclusive
 		false,   // no-wait
+		nil,     // arguments
 	)
 	failOnError(err, "Failed to declare a queue")
 
@@ -40,6 +44,7 @@ func main() {
 			err = ch.Publish(
 				"",      // exchange
 				q.Queue, // routing key
+				false,   // mandatory
 				false,   // immediate
 				qclient.MetaDataWithBody{
 					ContentType:   "text/plain",
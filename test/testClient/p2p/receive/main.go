@@ -23,7 +23,11 @@ func main() {
 
 	q, err := ch.QueueDeclare(
 		"hello", // name
+		false,   // durable
+		false,   // autoDelete
+		false,   // exclusive
 		false,   // no-wait
+		nil,     // arguments
 	)
 	failOnError(err, "Failed to declare a queue")
 
@@ -32,6 +36,7 @@ func main() {
 		"hello", // consumer ** Need to pass **
 		true,    // noAck
 		false,   // noWait
+		nil,     // arguments
 	)
 	failOnError(err, "Failed to register a consumer")
 
@@ -23,7 +23,11 @@ func main() {
 
 	q, err := ch.QueueDeclare(
 		"hello", // name
+		false,   // durable
+		false,   // autoDelete
+		false,   // exclusive
 		false,   // no-wait
+		nil,     // arguments
 	)
 	failOnError(err, "Failed to declare a queue")
 
@@ -31,6 +35,7 @@ func main() {
 	err = ch.Publish(
 		"",      // exchange
 		q.Queue, // routing key
+		false,   // mandatory
 		false,   // immediate
 		qclient.MetaDataWithBody{
 			ContentType:   "text/plain",